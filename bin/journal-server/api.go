@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/thijzert/go-journal"
+	"github.com/thijzert/go-journal/bin/journal-server/secretbookmark"
+)
+
+// APIMaxBodySize is the maximum size of a request body in the JSON API
+const APIMaxBodySize int64 = 1 << 20
+
+// An apiEntry is a journal entry, as returned by the JSON API
+type apiEntry struct {
+	ID       string    `json:"id"`
+	Date     time.Time `json:"date"`
+	Starred  bool      `json:"starred"`
+	Title    string    `json:"title"`
+	Tags     []string  `json:"tags"`
+	Contents string    `json:"contents"`
+}
+
+func newAPIEntry(e readEntry) apiEntry {
+	tags := e.Tags()
+	if tags == nil {
+		tags = []string{}
+	}
+	return apiEntry{
+		ID:       e.ID,
+		Date:     e.Date,
+		Starred:  e.Starred,
+		Title:    e.Title(),
+		Tags:     tags,
+		Contents: e.Contents,
+	}
+}
+
+// An apiNewEntry is the request body for adding an entry
+type apiNewEntry struct {
+	// Date is the date of the entry. It is either in RFC 3339 format, or
+	// anything that jrnl understands. If it's empty, the contents may start
+	// with a date instead.
+	Date        string   `json:"date"`
+	Starred     bool     `json:"starred"`
+	Contents    string   `json:"contents"`
+	Project     string   `json:"project"`
+	Attachments []string `json:"attachments"`
+}
+
+// APIRequire wraps an API endpoint, and only allows access if the request
+// context has a user with permission p. Requests other than GET that were
+// authenticated with a session cookie also need a CSRF token. Access is
+// denied with a JSON error.
+func APIRequire(p secretbookmark.Permission, f func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p == secretbookmark.Read && *read_password_file == "" {
+			writeJSONError(w, 503, 503, "Reading entries is not enabled on this server")
+			return
+		}
+		user, ok := secretbookmark.User(r.Context(), p)
+		if !ok {
+			writeJSONError(w, 403, 403, "Access denied")
+			return
+		}
+		if r.Method != "GET" && r.Method != "HEAD" && !secretbookmark.CheckCSRF(r, p) {
+			log.Printf("Refusing %s %s for user '%s': invalid CSRF token", r.Method, r.URL.Path, user)
+			writeJSONError(w, 403, 403, "Access denied")
+			return
+		}
+		f(w, r)
+	}
+}
+
+// APIAddEntryHandler adds a new entry to the journal
+func APIAddEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var req apiNewEntry
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, APIMaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSONError(w, 400, 400, "Invalid request body: "+err.Error())
+		return
+	}
+
+	timestamp := time.Now()
+	if req.Date != "" {
+		t, err := time.Parse(time.RFC3339, req.Date)
+		if err != nil {
+			var ok bool
+			t, ok = journal.ParseTime(req.Date, time.Now())
+			if !ok {
+				writeJSONError(w, 400, 400, fmt.Sprintf("Invalid date '%s'", req.Date))
+				return
+			}
+		}
+		// The journal stores local times without a time zone
+		timestamp = t.In(time.Local)
+	}
+	timestamp, body, starred := prepareEntry(timestamp, req.Date != "", req.Contents, req.Starred)
+	if strings.TrimSpace(body) == "" {
+		writeJSONError(w, 400, 400, "The entry is empty")
+		return
+	}
+
+	if req.Project != "" {
+		projects, _ := listProjects(r.Context())
+		found := false
+		for _, p := range projects {
+			found = found || p == req.Project
+		}
+		if !found {
+			writeJSONError(w, 400, 400, fmt.Sprintf("Unknown project '%s'", req.Project))
+			return
+		}
+	}
+
+	if len(req.Attachments) > 0 && *attachments_dir == "" {
+		writeJSONError(w, 503, 503, "Attachments are not available on this server")
+		return
+	}
+	attachmentMutex.Lock()
+	for _, att_hash := range req.Attachments {
+		if _, err := hex.DecodeString(att_hash); err != nil || len(att_hash) != 64 {
+			attachmentMutex.Unlock()
+			writeJSONError(w, 400, 400, fmt.Sprintf("Unknown attachment '%s'", att_hash))
+			return
+		}
+		if e, uploaded := attachments[att_hash]; uploaded && e.User != loginName(r) {
+			attachmentMutex.Unlock()
+			writeJSONError(w, 400, 400, fmt.Sprintf("Unknown attachment '%s'", att_hash))
+			return
+		} else if uploaded && !e.Complete {
+			attachmentMutex.Unlock()
+			writeJSONError(w, 400, 400, fmt.Sprintf("Attachment '%s' is incomplete", att_hash))
+			return
+		} else if _, stored := storedHash(att_hash); !uploaded && !stored {
+			attachmentMutex.Unlock()
+			writeJSONError(w, 400, 400, fmt.Sprintf("Unknown attachment '%s'", att_hash))
+			return
+		}
+	}
+	attachmentMutex.Unlock()
+
+	user := loginName(r)
+	e, err := saveJournalEntry(timestamp, body, req.Project, req.Attachments, starred, user)
+	if e == nil {
+		log.Printf("error saving journal entry for user '%s': %v", user, err)
+		writeJSONError(w, 500, 500, "Error saving journal entry")
+		return
+	}
+	message := "Entry added"
+	if err != nil {
+		log.Printf("error saving journal entry for user '%s': %v", user, err)
+		message = "Entry added, but not all attachments could be saved"
+	}
+
+	rv := readEntry{Entry: e}
+	if days, err := readJournal(user, journal.Query{}); err == nil {
+		// The ID depends on other entries in the same minute, so look it up.
+		// The journal only stores dates up to the minute.
+		date := e.Date.Truncate(time.Minute)
+		for _, d := range days {
+			for _, de := range d.Entries {
+				if de.Date.Equal(date) && de.Starred == e.Starred && de.Contents == e.Contents {
+					rv = de
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Location", "entries/"+rv.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		OK      int      `json:"ok"`
+		Message string   `json:"_"`
+		Entry   apiEntry `json:"entry"`
+	}{1, message, newAPIEntry(rv)})
+}
+
+// APIEntriesHandler lists all entries that match the query
+func APIEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	getv := r.URL.Query()
+	q := journal.Query{
+		Terms: strings.Fields(getv.Get("query")),
+		Folding: journal.Folding{
+			IgnoreCase:    true,
+			IgnoreAccents: true,
+		},
+		Starred: getv.Get("starred") != "",
+		Tags:    getv["tag"],
+	}
+
+	if from := getv.Get("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			writeJSONError(w, 400, 400, fmt.Sprintf("Invalid date '%s'", from))
+			return
+		}
+		q.From = t
+	}
+	if to := getv.Get("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			writeJSONError(w, 400, 400, fmt.Sprintf("Invalid date '%s'", to))
+			return
+		}
+		q.To = t.AddDate(0, 0, 1)
+	}
+	limit := 0
+	if l := getv.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeJSONError(w, 400, 400, fmt.Sprintf("Invalid limit '%s'", l))
+			return
+		}
+		limit = n
+	}
+
+	days, err := readJournal(readerName(r), q)
+	if err != nil {
+		log.Printf("error reading journal: %v", err)
+		writeJSONError(w, 500, 500, "Error reading journal")
+		return
+	}
+
+	entries := []apiEntry{}
+	for _, d := range days {
+		for _, e := range d.Entries {
+			entries = append(entries, newAPIEntry(e))
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	writeJSON(w, struct {
+		OK      int        `json:"ok"`
+		Message string     `json:"_"`
+		Entries []apiEntry `json:"entries"`
+	}{1, fmt.Sprintf("%d entries", len(entries)), entries})
+}
+
+// APIEntryHandler returns a single entry
+func APIEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	days, err := readJournal(readerName(r), journal.Query{})
+	if err != nil {
+		log.Printf("error reading journal: %v", err)
+		writeJSONError(w, 500, 500, "Error reading journal")
+		return
+	}
+
+	for _, d := range days {
+		for _, e := range d.Entries {
+			if e.ID == id {
+				writeJSON(w, struct {
+					OK      int      `json:"ok"`
+					Message string   `json:"_"`
+					Entry   apiEntry `json:"entry"`
+				}{1, "Entry found", newAPIEntry(e)})
+				return
+			}
+		}
+	}
+
+	writeJSONError(w, 404, 404, "Entry not found")
+}
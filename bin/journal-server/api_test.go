@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thijzert/go-journal/bin/journal-server/secretbookmark"
+)
+
+func TestAPIAddEntryDate(t *testing.T) {
+	defer func(loc *time.Location, filename string) {
+		time.Local, *journal_file = loc, filename
+	}(time.Local, *journal_file)
+	time.Local = time.FixedZone("UTC+1", 3600)
+
+	dir := t.TempDir()
+	passwordFile := path.Join(dir, ".htpasswd")
+	// The password is 'password'
+	if err := os.WriteFile(passwordFile, []byte("alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	handler := secretbookmark.New("apikey", passwordFile).Middleware(http.HandlerFunc(APIRequire(secretbookmark.Write, APIAddEntryHandler)))
+
+	cases := []struct {
+		date string
+		line string
+		id   string
+	}{
+		{"2023-02-01T15:16:00+09:00", "2023-02-01 07:16", "202302010716"},
+		{"2023-02-01T23:30:00-05:00", "2023-02-02 05:30", "202302020530"},
+		{"2023-02-01T15:16:00Z", "2023-02-01 16:16", "202302011616"},
+		{"2023-02-01T15:16:00+01:00", "2023-02-01 15:16", "202302011516"},
+		{"2023-02-01 15:16", "2023-02-01 15:16", "202302011516"},
+	}
+
+	for i, c := range cases {
+		*journal_file = path.Join(dir, "journal"+string(rune('a'+i))+".txt")
+		if err := os.WriteFile(*journal_file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		body := `{"date": "` + c.date + `", "contents": "Hello"}`
+		r := httptest.NewRequest("POST", "/api/v1/entries?apikey=password", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("%s: status %d: %s", c.date, w.Code, w.Body)
+			continue
+		}
+		var rv struct {
+			Entry struct {
+				ID string `json:"id"`
+			} `json:"entry"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&rv); err != nil {
+			t.Errorf("%s: %v", c.date, err)
+		}
+		if rv.Entry.ID != c.id {
+			t.Errorf("%s: ID is '%s', want '%s'", c.date, rv.Entry.ID, c.id)
+		}
+		if loc := w.Header().Get("Location"); loc != "entries/"+c.id {
+			t.Errorf("%s: Location is '%s', want 'entries/%s'", c.date, loc, c.id)
+		}
+
+		stored, err := os.ReadFile(*journal_file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(strings.TrimLeft(string(stored), "\n"), c.line+" Hello") {
+			t.Errorf("%s: stored as %q, want it at %s", c.date, stored, c.line)
+		}
+	}
+}
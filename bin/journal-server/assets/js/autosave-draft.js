@@ -8,6 +8,7 @@ const AUTOSAVE_INTERVAL_MS = 2500;
 	const ipt_body = editform.querySelector("textarea");
 	const ipt_project = editform.querySelector("#ipt-project") || document.createElement("input");
 	const ipt_draft_id = editform.querySelector("input[type=hidden][name=draft_id]");
+	const ipt_csrf_token = editform.querySelector("input[type=hidden][name=csrf_token]");
 	if ( !ipt_body || !ipt_draft_id ) {
 		return;
 	}
@@ -34,6 +35,9 @@ const AUTOSAVE_INTERVAL_MS = 2500;
 		try {
 			let pb = new FormData();
 			pb.set("draft_id", draft_id);
+			if ( ipt_csrf_token ) {
+				pb.set("csrf_token", ipt_csrf_token.value);
+			}
 			pb.set("body", ipt_body.value);
 			pb.set("project", ipt_project.value);
 
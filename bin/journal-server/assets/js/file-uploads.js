@@ -2,6 +2,7 @@
 	const body_ipt = document.getElementById("ipt-body");
 	const file_ipt = document.getElementById("ipt-file-upload");
 	const file_list = document.getElementById("list-of-attached-files");
+	const csrf_ipt = document.getElementById("ipt-csrf-token");
 
 	if ( !file_ipt || !file_ipt.files || !file_list ) {
 		return;
@@ -18,8 +19,8 @@
 		}
 
 		let chunk = file.buf.slice(file.offset, file.offset+CHUNKSIZE);
-		if ( chunk.byteLength == 0 ) {
-			file.pr.parentNode.appendChild(document.createTextNode("√"));
+		if ( file.complete || chunk.byteLength == 0 ) {
+			file.pr.parentNode.appendChild(document.createTextNode(file.complete ? "√" : "×"));
 			file.pr.remove();
 			return;
 		}
@@ -30,19 +31,32 @@
 			att_url.searchParams.set(k, this_url.searchParams.get(k));
 		}
 		att_url.searchParams.set("att_hash", file.hash);
+		att_url.searchParams.set("offset", file.offset);
 
-		let q = await fetch(att_url, {method: "POST", body: chunk});
+		let headers = {};
+		if ( csrf_ipt ) {
+			headers["X-CSRF-Token"] = csrf_ipt.value;
+		}
+		let q = await fetch(att_url, {method: "POST", body: chunk, headers});
 		q = await q.json();
-		if ( !q.ok ) {
+		if ( !q.ok && q.error != 409 ) {
 			console.error(q);
 			file.pr.parentNode.appendChild(document.createTextNode("×"));
 			file.pr.remove();
 			return;
 		}
 
-		file.pr.max = Math.ceil(file.buf.byteLength / CHUNKSIZE);
-		file.pr.value = Math.floor(file.offset / CHUNKSIZE);
-		file.offset += chunk.byteLength;
+		// Continue wherever the server is at; it may already have (part of) the file
+		file.pr.max = file.buf.byteLength;
+		file.pr.value = q.file_length;
+		file.offset = q.file_length;
+		file.complete = q.complete;
+
+		// Suggest the time a photo was taken as the time of the entry
+		const ts_ipt = document.getElementById("ipt-ts");
+		if ( q.taken && ts_ipt && ts_ipt.value == "" ) {
+			ts_ipt.value = q.taken;
+		}
 
 		return await upload_buf(hash);
 	}
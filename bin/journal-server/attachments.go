@@ -0,0 +1,109 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// inlineTypes lists the content types that are safe to show in the browser.
+// Anything else is offered as a download.
+var inlineTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"audio/",
+	"video/",
+	"text/plain",
+}
+
+// A readAttachment is a file attached to an entry, as shown in the read-only
+// UI
+type readAttachment struct {
+	Hash      string
+	URL       template.URL
+	Thumbnail template.URL
+	Image     bool
+}
+
+// sniffAttachment determines the content type of a stored attachment
+func sniffAttachment(f io.ReadSeeker) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// attachmentType returns the content type of the attachment with this hash
+func attachmentType(att_hash string) (string, error) {
+	f, err := os.Open(path.Join(*attachments_dir, att_hash))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sniffAttachment(f)
+}
+
+func isInlineType(ctype string) bool {
+	for _, t := range inlineTypes {
+		if strings.HasPrefix(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachmentHandler serves a stored attachment. Attachments never change, so
+// they may be cached indefinitely.
+func AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	att_hash := mux.Vars(r)["hash"]
+	if *attachments_dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(path.Join(*attachments_dir, att_hash))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		errorHandler(err, w, r)
+		return
+	}
+	ctype, err := sniffAttachment(f)
+	if err != nil {
+		errorHandler(err, w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("ETag", `"`+att_hash+`"`)
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	h.Set("Referrer-Policy", "no-referrer")
+
+	// Uploaded files could be anything; make sure the browser never runs them
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !isInlineType(ctype) {
+		h.Set("Content-Disposition", "attachment; filename=\""+att_hash+"\"")
+	}
+
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
@@ -22,9 +22,13 @@ type bwvCheck struct {
 	Concerts []concert
 }
 
+// bwvFolding is used to normalize BWV tags and catalogue numbers, so that
+// "@bwv 140" and "@BWV 140" are counted as the same performance.
+var bwvFolding = journal.Folding{IgnoreCase: true, IgnoreAccents: true}
+
 func BWVHandler(w http.ResponseWriter, r *http.Request) {
 	doneDeal := make(map[string][]concert)
-	rbwv := regexp.MustCompile("@BWV\\s+((([Aa]nh\\.?)\\s*)?(\\d+)([a-zA-Z])?(-\\d+)?)")
+	rbwv := regexp.MustCompile("(?i)@BWV\\s+((([Aa]nh\\.?)\\s*)?(\\d+)([a-zA-Z])?(-\\d+)?)")
 
 	c := make(chan *journal.Entry, 20)
 	f, err := os.Open(*journal_file)
@@ -45,6 +49,7 @@ func BWVHandler(w http.ResponseWriter, r *http.Request) {
 			if m[3] != "" {
 				norm = "Anh. " + norm
 			}
+			norm = bwvFolding.Fold(norm)
 
 			conc := concert{
 				Date: e.Date.Format("2006-01-02"),
@@ -53,7 +58,7 @@ func BWVHandler(w http.ResponseWriter, r *http.Request) {
 			if time.Since(e.Date) > 1*365*24*time.Hour {
 				lines := strings.Split(e.Contents, "\n")
 				for _, l := range lines {
-					if len(l) < 5 || l[0:4] == "@BWV" {
+					if len(l) < 5 || bwvFolding.Fold(l[0:4]) == "@bwv" {
 						continue
 					}
 					conc.Description = l
@@ -74,7 +79,7 @@ func BWVHandler(w http.ResponseWriter, r *http.Request) {
 	for _, sect := range bach.AllCantatas {
 		ns := make([]bwvCheck, len(sect))
 		for i, c := range sect {
-			dd, ok := doneDeal[c.BWV]
+			dd, ok := doneDeal[bwvFolding.Fold(c.BWV)]
 			ns[i] = bwvCheck{
 				BWV:      c,
 				Done:     ok && len(dd) > 0,
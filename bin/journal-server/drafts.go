@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// validDraftID checks if a draft ID is safe to use as a file name
+func validDraftID(draft_id string) bool {
+	if len(draft_id) != 12 {
+		return false
+	}
+	_, err := hex.DecodeString(draft_id)
+	return err == nil
+}
+
+// ownedBy checks if a draft may be changed by a user. Drafts saved before
+// authors were recorded belong to everyone.
+func (d draftEntry) ownedBy(user string) bool {
+	return d.Author == "" || d.Author == user
+}
+
+func draftPath(draft_id string) string {
+	return path.Join(*drafts_dir, draft_id+".json")
+}
+
+// storeDraft writes a draft to the drafts directory, so it survives a crash.
+// The caller should hold draftsMutex.
+func storeDraft(draft_id string, entry draftEntry) error {
+	if *drafts_dir == "" {
+		return nil
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so a crash never leaves half a draft
+	tmp := draftPath(draft_id) + "~"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, draftPath(draft_id))
+}
+
+// forgetDraft removes a draft from memory and from the drafts directory. The
+// caller should hold draftsMutex.
+func forgetDraft(draft_id string) {
+	delete(drafts, draft_id)
+	if *drafts_dir == "" {
+		return
+	}
+	if err := os.Remove(draftPath(draft_id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error removing draft ID %s: %v", draft_id, err)
+	}
+}
+
+// loadDrafts reads all drafts that were saved before the server was last
+// stopped
+func loadDrafts() error {
+	if *drafts_dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(*drafts_dir, 0700); err != nil {
+		return err
+	}
+
+	fis, err := os.ReadDir(*drafts_dir)
+	if err != nil {
+		return err
+	}
+
+	draftsMutex.Lock()
+	defer draftsMutex.Unlock()
+
+	for _, fi := range fis {
+		draft_id := strings.TrimSuffix(fi.Name(), ".json")
+		if fi.IsDir() || draft_id == fi.Name() || !validDraftID(draft_id) {
+			continue
+		}
+
+		buf, err := os.ReadFile(path.Join(*drafts_dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		var entry draftEntry
+		if err := json.Unmarshal(buf, &entry); err != nil {
+			log.Printf("Error reading draft ID %s: %v", draft_id, err)
+			continue
+		}
+
+		drafts[draft_id] = entry
+		log.Printf("Restored draft ID %s: last saved at %s", draft_id, entry.LastEdit)
+	}
+
+	return nil
+}
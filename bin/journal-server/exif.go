@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// This file contains just enough of an EXIF parser to find the capture time
+// and orientation of a JPEG photo, and to remove its GPS location.
+
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// exifTypeSizes holds the size in bytes of each EXIF data type
+var exifTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// An exifData is the TIFF structure in the APP1 segment of a JPEG file. It
+// refers to the original file, so changes are made in place.
+type exifData struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+// An exifEntry is a single tag in an IFD
+type exifEntry struct {
+	// offset is the position of the entry in the TIFF structure
+	offset uint32
+
+	Tag, Type uint16
+	Count     uint32
+}
+
+// findExif locates the EXIF data in a JPEG file
+func findExif(jpeg []byte) (*exifData, bool) {
+	if len(jpeg) < 4 || jpeg[0] != 0xff || jpeg[1] != 0xd8 {
+		return nil, false
+	}
+
+	for i := 2; i+4 <= len(jpeg); {
+		if jpeg[i] != 0xff {
+			return nil, false
+		}
+		marker := jpeg[i+1]
+		if marker == 0xda || marker == 0xd9 {
+			// Start of the image data; there's no EXIF data
+			return nil, false
+		}
+		length := int(binary.BigEndian.Uint16(jpeg[i+2:]))
+		if length < 2 || i+2+length > len(jpeg) {
+			return nil, false
+		}
+
+		segment := jpeg[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			x := &exifData{tiff: segment[6:]}
+			if len(x.tiff) < 8 {
+				return nil, false
+			}
+			switch string(x.tiff[:2]) {
+			case "II":
+				x.order = binary.LittleEndian
+			case "MM":
+				x.order = binary.BigEndian
+			default:
+				return nil, false
+			}
+			return x, true
+		}
+		i += 2 + length
+	}
+	return nil, false
+}
+
+// ifd returns the entries in the IFD at offset
+func (x *exifData) ifd(offset uint32) []exifEntry {
+	if offset == 0 || uint64(offset)+2 > uint64(len(x.tiff)) {
+		return nil
+	}
+	n := uint32(x.order.Uint16(x.tiff[offset:]))
+	if uint64(offset)+2+12*uint64(n) > uint64(len(x.tiff)) {
+		return nil
+	}
+
+	rv := make([]exifEntry, n)
+	for i := range rv {
+		o := offset + 2 + 12*uint32(i)
+		rv[i] = exifEntry{
+			offset: o,
+			Tag:    x.order.Uint16(x.tiff[o:]),
+			Type:   x.order.Uint16(x.tiff[o+2:]),
+			Count:  x.order.Uint32(x.tiff[o+4:]),
+		}
+	}
+	return rv
+}
+
+// ifd0 returns the entries in the first IFD
+func (x *exifData) ifd0() []exifEntry {
+	return x.ifd(x.order.Uint32(x.tiff[4:]))
+}
+
+// value returns the raw value of an entry, or nil if it is out of bounds
+func (x *exifData) value(e exifEntry) []byte {
+	size := uint64(exifTypeSizes[e.Type]) * uint64(e.Count)
+	offset := uint64(e.offset + 8)
+	if size > 4 {
+		offset = uint64(x.order.Uint32(x.tiff[e.offset+8:]))
+	}
+	if offset+size > uint64(len(x.tiff)) {
+		return nil
+	}
+	return x.tiff[offset : offset+size]
+}
+
+// uint returns the value of an entry that holds a single integer
+func (x *exifData) uint(e exifEntry) (uint32, bool) {
+	v := x.value(e)
+	if e.Count != 1 || v == nil {
+		return 0, false
+	}
+	switch e.Type {
+	case 3:
+		return uint32(x.order.Uint16(v)), true
+	case 4:
+		return x.order.Uint32(v), true
+	}
+	return 0, false
+}
+
+// findExifTag returns the entry for a tag in an IFD
+func findExifTag(entries []exifEntry, tag uint16) (exifEntry, bool) {
+	for _, e := range entries {
+		if e.Tag == tag {
+			return e, true
+		}
+	}
+	return exifEntry{}, false
+}
+
+// CaptureTime returns the date and time the photo was taken. EXIF dates have
+// no time zone, so they're taken to be in the server's time zone.
+func (x *exifData) CaptureTime() (time.Time, bool) {
+	ifd0 := x.ifd0()
+	candidates := []exifEntry{}
+	if e, ok := findExifTag(ifd0, exifTagExifIFD); ok {
+		if offset, ok := x.uint(e); ok {
+			if e, ok := findExifTag(x.ifd(offset), exifTagDateTimeOriginal); ok {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if e, ok := findExifTag(ifd0, exifTagDateTime); ok {
+		candidates = append(candidates, e)
+	}
+
+	for _, e := range candidates {
+		v := bytes.TrimRight(x.value(e), "\x00 ")
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", string(v), time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Orientation returns the EXIF orientation of the photo, from 1 to 8
+func (x *exifData) Orientation() int {
+	if e, ok := findExifTag(x.ifd0(), exifTagOrientation); ok {
+		if v, ok := x.uint(e); ok && v >= 1 && v <= 8 {
+			return int(v)
+		}
+	}
+	return 1
+}
+
+// gpsIFD returns the offset of the IFD with the GPS location, and its entries
+func (x *exifData) gpsIFD() (uint32, []exifEntry) {
+	e, ok := findExifTag(x.ifd0(), exifTagGPSIFD)
+	if !ok {
+		return 0, nil
+	}
+	offset, ok := x.uint(e)
+	if !ok {
+		return 0, nil
+	}
+	return offset, x.ifd(offset)
+}
+
+// HasGPS checks if the photo has a GPS location
+func (x *exifData) HasGPS() bool {
+	_, entries := x.gpsIFD()
+	return len(entries) > 0
+}
+
+// StripGPS removes the GPS location from the photo. The GPS data is
+// overwritten with zeroes, so the file keeps its size and structure. It
+// returns true if there was anything to remove.
+func (x *exifData) StripGPS() bool {
+	offset, entries := x.gpsIFD()
+	if len(entries) == 0 {
+		return false
+	}
+
+	for _, ge := range entries {
+		if v := x.value(ge); v != nil {
+			for i := range v {
+				v[i] = 0
+			}
+		}
+		for i := ge.offset; i < ge.offset+12; i++ {
+			x.tiff[i] = 0
+		}
+	}
+	// An IFD with no entries
+	x.order.PutUint16(x.tiff[offset:], 0)
+	return true
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// The TIFF structure made by testTIFF. IFD0 has the orientation, the date and
+// time, and pointers to the Exif and GPS IFDs, in that order.
+const (
+	testIFD0         = 8
+	testExifIFD      = 62
+	testGPSIFD       = 80
+	testDateTime     = 110
+	testDateOriginal = 130
+	testLatitude     = 150
+	testTIFFSize     = 174
+)
+
+// testTIFF returns the TIFF structure of the EXIF data of a photo, taken on
+// 2023-05-06 07:08:09 with orientation 6, and with a GPS location
+func testTIFF(order binary.ByteOrder) []byte {
+	tiff := make([]byte, testTIFFSize)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], testIFD0)
+
+	entry := func(offset int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(tiff[offset:], tag)
+		order.PutUint16(tiff[offset+2:], typ)
+		order.PutUint32(tiff[offset+4:], count)
+		order.PutUint32(tiff[offset+8:], value)
+	}
+
+	order.PutUint16(tiff[testIFD0:], 4)
+	entry(testIFD0+2, exifTagOrientation, 3, 1, 0)
+	order.PutUint16(tiff[testIFD0+10:], 6)
+	entry(testIFD0+14, exifTagDateTime, 2, 20, testDateTime)
+	entry(testIFD0+26, exifTagExifIFD, 4, 1, testExifIFD)
+	entry(testIFD0+38, exifTagGPSIFD, 4, 1, testGPSIFD)
+
+	order.PutUint16(tiff[testExifIFD:], 1)
+	entry(testExifIFD+2, exifTagDateTimeOriginal, 2, 20, testDateOriginal)
+
+	order.PutUint16(tiff[testGPSIFD:], 2)
+	entry(testGPSIFD+2, 0x0001, 2, 2, 0)
+	copy(tiff[testGPSIFD+10:], "N\x00")
+	entry(testGPSIFD+14, 0x0002, 5, 3, testLatitude)
+
+	copy(tiff[testDateTime:], "2023:05:07 10:11:12\x00")
+	copy(tiff[testDateOriginal:], "2023:05:06 07:08:09\x00")
+	for i := 0; i < 3; i++ {
+		order.PutUint32(tiff[testLatitude+8*i:], 52+uint32(i))
+		order.PutUint32(tiff[testLatitude+8*i+4:], 1)
+	}
+	return tiff
+}
+
+// testJPEG wraps EXIF data in a JPEG file
+func testJPEG(tiff []byte) []byte {
+	rv := []byte{0xff, 0xd8, 0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(rv[4:], uint16(2+6+len(tiff)))
+	rv = append(rv, "Exif\x00\x00"...)
+	rv = append(rv, tiff...)
+	return append(rv, 0xff, 0xda, 0, 2, 0xff, 0xd9)
+}
+
+// exifResult holds what the EXIF parser finds in a file
+type exifResult struct {
+	found       bool
+	captureTime string
+	orientation int
+	strip       bool
+}
+
+// parseTestExif runs a JPEG file through the EXIF parser. A panic is
+// reported as an error.
+func parseTestExif(t *testing.T, name string, jpeg []byte) (rv exifResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%s: panic: %v", name, r)
+		}
+	}()
+
+	x, ok := findExif(jpeg)
+	if !ok {
+		return
+	}
+	rv.found = true
+	if ts, ok := x.CaptureTime(); ok {
+		rv.captureTime = ts.Format("2006-01-02 15:04:05")
+	}
+	rv.orientation = x.Orientation()
+	rv.strip = x.StripGPS()
+
+	// Whatever is left should still be readable
+	x.CaptureTime()
+	x.Orientation()
+	x.StripGPS()
+	return
+}
+
+func TestExif(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		jpeg := testJPEG(testTIFF(order))
+		got := parseTestExif(t, order.String(), jpeg)
+		want := exifResult{true, "2023-05-06 07:08:09", 6, true}
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", order, got, want)
+		}
+
+		x, _ := findExif(jpeg)
+		for i, b := range x.tiff[testLatitude:] {
+			if b != 0 {
+				t.Errorf("%s: byte %d of the GPS location was not removed", order, i)
+				break
+			}
+		}
+		if x.StripGPS() {
+			t.Errorf("%s: the GPS location was removed twice", order)
+		}
+		if ts, ok := x.CaptureTime(); !ok || !ts.Equal(time.Date(2023, 5, 6, 7, 8, 9, 0, time.Local)) {
+			t.Errorf("%s: capture time after removing the GPS location is %s, %v", order, ts, ok)
+		}
+	}
+}
+
+func TestExifMalformed(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(tiff []byte, order binary.ByteOrder)
+		want   exifResult
+	}{
+		{"no changes", func(tiff []byte, order binary.ByteOrder) {}, exifResult{true, "2023-05-06 07:08:09", 6, true}},
+
+		{"unknown byte order", func(tiff []byte, order binary.ByteOrder) {
+			copy(tiff, "XX")
+		}, exifResult{}},
+		{"IFD0 past the end", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[4:], 0xfffffff0)
+		}, exifResult{true, "", 1, false}},
+		{"IFD0 at the last byte", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[4:], testTIFFSize-1)
+		}, exifResult{true, "", 1, false}},
+		{"too many entries in IFD0", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testIFD0:], 0xffff)
+		}, exifResult{true, "", 1, false}},
+
+		{"unknown type", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testIFD0+4:], 0xffff)
+		}, exifResult{true, "2023-05-06 07:08:09", 1, true}},
+		{"orientation out of range", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testIFD0+10:], 9)
+		}, exifResult{true, "2023-05-06 07:08:09", 1, true}},
+		{"two orientations", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testIFD0+6:], 2)
+		}, exifResult{true, "2023-05-06 07:08:09", 1, true}},
+
+		{"Exif IFD past the end", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testIFD0+34:], 0xffffff00)
+		}, exifResult{true, "2023-05-07 10:11:12", 6, true}},
+		{"Exif IFD pointer is a string", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testIFD0+28:], 2)
+		}, exifResult{true, "2023-05-07 10:11:12", 6, true}},
+		{"date past the end", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testExifIFD+10:], 0xfffffff0)
+		}, exifResult{true, "2023-05-07 10:11:12", 6, true}},
+		{"date too long", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testExifIFD+6:], 0xffffffff)
+		}, exifResult{true, "2023-05-07 10:11:12", 6, true}},
+		{"no valid dates", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testExifIFD+10:], 0xfffffff0)
+			order.PutUint32(tiff[testIFD0+22:], testTIFFSize-4)
+		}, exifResult{true, "", 6, true}},
+		{"invalid date", func(tiff []byte, order binary.ByteOrder) {
+			copy(tiff[testDateOriginal:], "2023:13:06 07:08:09")
+		}, exifResult{true, "2023-05-07 10:11:12", 6, true}},
+
+		{"GPS IFD past the end", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testIFD0+46:], 0xffffff00)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, false}},
+		{"GPS IFD at the last byte", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testIFD0+46:], testTIFFSize-1)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, false}},
+		{"GPS IFD pointer is a short", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testIFD0+40:], 3)
+			order.PutUint32(tiff[testIFD0+46:], 0)
+			order.PutUint16(tiff[testIFD0+46:], testGPSIFD)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, true}},
+		{"empty GPS IFD", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint16(tiff[testGPSIFD:], 0)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, false}},
+		{"GPS location past the end", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testGPSIFD+22:], 0xfffffff0)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, true}},
+		{"GPS IFD is IFD0", func(tiff []byte, order binary.ByteOrder) {
+			order.PutUint32(tiff[testIFD0+46:], testIFD0)
+		}, exifResult{true, "2023-05-06 07:08:09", 6, true}},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, c := range cases {
+			tiff := testTIFF(order)
+			c.modify(tiff, order)
+			name := order.String() + ": " + c.name
+			if got := parseTestExif(t, name, testJPEG(tiff)); got != c.want {
+				t.Errorf("%s: got %+v, want %+v", name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestExifTruncated(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		tiff := testTIFF(order)
+		for n := 0; n < len(tiff); n++ {
+			parseTestExif(t, order.String()+": TIFF truncated", testJPEG(append([]byte(nil), tiff[:n]...)))
+		}
+
+		jpeg := testJPEG(tiff)
+		for n := 0; n < len(jpeg); n++ {
+			truncated := append([]byte(nil), jpeg[:n]...)
+			if got := parseTestExif(t, order.String()+": JPEG truncated", truncated); got.found && n < 12+len(tiff) {
+				t.Errorf("%s: found EXIF data in a JPEG file truncated to %d bytes", order, n)
+			}
+		}
+	}
+}
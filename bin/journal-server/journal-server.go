@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"net"
@@ -15,8 +17,10 @@ import (
 	"os/signal"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -31,6 +35,19 @@ var (
 	secret_parameter = flag.String("secret_parameter", "apikey", "Parameter name containing the API key")
 	attachments_dir  = flag.String("attachments_dir", "", "Directory for storing attached files")
 	projects_dir     = flag.String("projects_dir", "", "Directory with project log files")
+	drafts_dir       = flag.String("drafts_dir", "", "Directory for storing unsaved drafts, so they survive a restart. If empty, drafts are only kept in memory")
+
+	max_attachment_size = flag.Int64("max_attachment_size", 64<<20, "Maximum size of an attached file, in bytes")
+	upload_quota        = flag.Int64("upload_quota", 1<<30, "Maximum total size of each user's uploads, including those attached to an entry, in bytes")
+	strip_gps           = flag.Bool("strip_gps", false, "Remove the GPS location from attached photos")
+
+	read_password_file = flag.String("read_password_file", "", "File containing passwords for the read-only UI. If empty, the read-only UI is disabled")
+	read_parameter     = flag.String("read_parameter", "readkey", "Parameter name containing the key for the read-only UI")
+
+	journals_dir = flag.String("journals_dir", "", "Directory with a journal for each user, named USER.txt. If empty, all users share the journal file")
+	lockout_log  = flag.String("lockout_log", "", "Append a line to this file whenever an IP address is locked out after trying too many wrong keys")
+
+	trusted_proxies = flag.String("trusted_proxies", "", "Comma-separated IP addresses or networks of reverse proxies that may set the X-Forwarded-Proto header")
 )
 
 // DraftTimeout measures how long it takes for an unsaved draft to get added to the journal.
@@ -42,6 +59,7 @@ const DraftExpireInterval time.Duration = 15 * time.Minute
 type draftEntry struct {
 	LastEdit      time.Time
 	Expires       time.Time
+	Author        string
 	Body          string
 	Project       string
 	AttachmentIDs []string
@@ -60,7 +78,17 @@ const AttachmentPurgeInterval time.Duration = 5 * time.Minute
 
 type attachmentEntry struct {
 	PurgeAt time.Time
-	Buf     []byte
+
+	// User is the user who uploaded the attachment
+	User string
+
+	// Size is the number of bytes received so far
+	Size int64
+
+	// Complete is set once the data received matches the attachment's hash
+	Complete bool
+
+	digest hash.Hash
 }
 
 var (
@@ -69,12 +97,12 @@ var (
 )
 
 func init() {
-	flag.Parse()
 	drafts = make(map[string]draftEntry)
 	attachments = make(map[string]attachmentEntry)
 }
 
 func main() {
+	flag.Parse()
 	err := run()
 	if err != nil {
 		log.Fatal(err)
@@ -82,20 +110,64 @@ func main() {
 }
 func run() error {
 	r := mux.NewRouter()
-	r.Methods("POST").Path("/journal/attachment").HandlerFunc(RequireLoggedIn(FileUploadHandler))
-	r.Methods("POST").Path("/journal/draft").HandlerFunc(RequireLoggedIn(SaveDraftHandler))
+	r.Methods("POST").Path("/journal/attachment").HandlerFunc(RequireLoggedIn(RequireCSRF(FileUploadHandler)))
+	r.Methods("POST").Path("/journal/draft").HandlerFunc(RequireLoggedIn(RequireCSRF(SaveDraftHandler)))
 	r.Methods("GET").Path("/journal").HandlerFunc(RequireLoggedIn(WriterHandler))
-	r.Methods("POST").Path("/journal").HandlerFunc(RequireLoggedIn(SaveHandler))
+	r.Methods("POST").Path("/journal").HandlerFunc(RequireLoggedIn(RequireCSRF(SaveHandler)))
 	r.Methods("GET").Path("/daily").HandlerFunc(RequireLoggedIn(DailyHandler))
-	r.Methods("POST").Path("/daily").HandlerFunc(RequireLoggedIn(SaveHandler))
+	r.Methods("POST").Path("/daily").HandlerFunc(RequireLoggedIn(RequireCSRF(SaveHandler)))
+	r.Methods("POST").Path("/api/v1/entries").HandlerFunc(APIRequire(secretbookmark.Write, APIAddEntryHandler))
+	r.Methods("GET").Path("/api/v1/entries").HandlerFunc(APIRequire(secretbookmark.Read, APIEntriesHandler))
+	r.Methods("GET").Path("/api/v1/entries/{id}").HandlerFunc(APIRequire(secretbookmark.Read, APIEntryHandler))
+	if *read_password_file != "" {
+		r.Methods("GET").Path("/journal/read").HandlerFunc(RequireReader(ReadHandler))
+		r.Methods("GET").Path("/journal/read/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}").HandlerFunc(RequireReader(ReadDayHandler))
+		r.Methods("GET").Path("/journal/read/entry/{id}").HandlerFunc(RequireReader(ReadEntryHandler))
+		r.Methods("GET").Path("/journal/attachment/{hash:[0-9a-f]{64}}").HandlerFunc(RequireReader(AttachmentHandler))
+		r.Methods("GET").Path("/journal/attachment/{hash:[0-9a-f]{64}}/thumbnail").HandlerFunc(RequireReader(ThumbnailHandler))
+	}
 	r.Path("/tie").HandlerFunc(AllTiesHandler)
 	r.Path("/tie/{date}.svg").HandlerFunc(TieHandler)
 	r.Path("/bwv").HandlerFunc(BWVHandler)
 	r.PathPrefix("/assets/").HandlerFunc(AssetHandler)
 	r.Path("/").HandlerFunc(IndexHandler)
 
+	if err := secretbookmark.TrustProxies(strings.Split(*trusted_proxies, ",")); err != nil {
+		return err
+	}
+
 	p := secretbookmark.New(*secret_parameter, *password_file)
+	if err := p.Validate(); err != nil {
+		return err
+	}
 	r.Use(p.Middleware)
+	if *lockout_log != "" {
+		f, err := os.OpenFile(*lockout_log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		p.LogLockouts(f)
+	}
+	if *read_password_file != "" {
+		if *read_parameter == *secret_parameter {
+			return fmt.Errorf("the read-only UI needs a different key parameter than '%s'", *secret_parameter)
+		}
+		rp := secretbookmark.NewStrong(*read_parameter, *read_password_file, secretbookmark.Read, ReaderMinKeyLength, p)
+		if err := rp.Validate(); err != nil {
+			return err
+		}
+		r.Use(rp.Middleware)
+	}
+
+	if err := loadDrafts(); err != nil {
+		return err
+	}
+	if *attachments_dir != "" {
+		if err := restoreUploads(); err != nil {
+			return err
+		}
+	}
 
 	defer onShutdown()
 
@@ -111,7 +183,7 @@ func run() error {
 	var l net.Listener
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 		cancel()
@@ -122,7 +194,11 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	log.Printf("Listening on '%s'; storing everything in '%s'.\n", *listen, *journal_file)
+	if *journals_dir != "" {
+		log.Printf("Listening on '%s'; storing every user's journal in '%s'.\n", *listen, *journals_dir)
+	} else {
+		log.Printf("Listening on '%s'; storing everything in '%s'.\n", *listen, *journal_file)
+	}
 
 	err = http.Serve(l, r)
 
@@ -141,10 +217,13 @@ func onShutdown() {
 	// Save all pending drafts.
 	draftsMutex.Lock()
 	for draft_id, entry := range drafts {
-		log.Printf("Add draft ID %s to journal: last saved at %s", draft_id, entry.LastEdit)
-		err := saveJournalEntry(entry.LastEdit, entry.Body, entry.Project, entry.AttachmentIDs, false)
+		log.Printf("Add draft ID %s by user '%s' to journal: last saved at %s", draft_id, entry.Author, entry.LastEdit)
+		e, err := saveJournalEntry(entry.LastEdit, entry.Body, entry.Project, entry.AttachmentIDs, false, entry.Author)
 		if err != nil {
-			log.Printf("Error saving journal entry: %v", err)
+			log.Printf("Error saving journal entry for user '%s': %v", entry.Author, err)
+		}
+		if e != nil {
+			forgetDraft(draft_id)
 		}
 	}
 	draftsMutex.Unlock()
@@ -159,7 +238,7 @@ func autoAddDrafts(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			break
+			return
 		case <-ticker.C:
 			toDelete := []string{}
 			draftsMutex.Lock()
@@ -168,16 +247,17 @@ func autoAddDrafts(ctx context.Context) {
 					continue
 				}
 
-				log.Printf("Draft ID %s expired at %s; saving it to journal", draft_id, entry.Expires)
-				err := saveJournalEntry(entry.LastEdit, entry.Body, entry.Project, entry.AttachmentIDs, false)
+				log.Printf("Draft ID %s by user '%s' expired at %s; saving it to journal", draft_id, entry.Author, entry.Expires)
+				e, err := saveJournalEntry(entry.LastEdit, entry.Body, entry.Project, entry.AttachmentIDs, false, entry.Author)
 				if err != nil {
-					log.Printf("Error saving journal entry: %v", err)
-				} else {
+					log.Printf("Error saving journal entry for user '%s': %v", entry.Author, err)
+				}
+				if e != nil {
 					toDelete = append(toDelete, draft_id)
 				}
 			}
 			for _, draft_id := range toDelete {
-				delete(drafts, draft_id)
+				forgetDraft(draft_id)
 			}
 			draftsMutex.Unlock()
 		}
@@ -216,8 +296,8 @@ func autoPurgeAttachments(ctx context.Context) {
 				toDelete = append(toDelete, att_hash)
 			}
 			for _, att_hash := range toDelete {
-				log.Printf("Deleting attachment with hash '%s'", att_hash)
-				delete(attachments, att_hash)
+				log.Printf("Deleting attachment with hash '%s' uploaded by user '%s'", att_hash, attachments[att_hash].User)
+				discardUpload(att_hash)
 			}
 			attachmentMutex.Unlock()
 		}
@@ -270,12 +350,14 @@ func WriterHandler(w http.ResponseWriter, r *http.Request) {
 	pageData := struct {
 		Success, Failure bool
 		Callback         string
+		CSRFToken        string
 		CanAttachFiles   bool
 		Projects         []string
 	}{
 		r.URL.Query().Get("success") != "",
 		r.URL.Query().Get("failure") != "",
 		"journal?" + getv.Encode(),
+		secretbookmark.CSRFToken(r.Context(), secretbookmark.Write),
 		*attachments_dir != "",
 		projects,
 	}
@@ -292,10 +374,12 @@ func DailyHandler(w http.ResponseWriter, r *http.Request) {
 	pageData := struct {
 		Success, Failure bool
 		Callback         string
+		CSRFToken        string
 	}{
 		r.URL.Query().Get("success") != "",
 		r.URL.Query().Get("failure") != "",
 		"daily?" + getv.Encode(),
+		secretbookmark.CSRFToken(r.Context(), secretbookmark.Write),
 	}
 
 	executeTemplate(daily, pageData, w, r)
@@ -322,20 +406,41 @@ func readAttachmentHashes(r *http.Request) []string {
 	return rv
 }
 
-func saveJournalEntry(timestamp time.Time, contents string, project string, attachmentIDs []string, starred bool) error {
+// journalFile returns the journal file for a user. If journals_dir is set,
+// every user has their own journal there; otherwise, all users share one.
+func journalFile(user string) (string, error) {
+	if *journals_dir == "" {
+		return *journal_file, nil
+	}
+	if user == "" || strings.ContainsAny(user, "/\\") || strings.HasPrefix(user, ".") {
+		return "", fmt.Errorf("invalid user name '%s'", user)
+	}
+	return path.Join(*journals_dir, user+".txt"), nil
+}
+
+// saveJournalEntry adds a new entry to the author's journal, and returns it
+func saveJournalEntry(timestamp time.Time, contents string, project string, attachmentIDs []string, starred bool, author string) (*journal.Entry, error) {
+	filename, err := journalFile(author)
+	if err != nil {
+		return nil, err
+	}
+
 	project_attachments_dir := ""
 	var nonFatalError error
 	if project != "" && *projects_dir != "" {
 		proj := strings.Replace(strings.Replace(project, "/", "", -1), "\\", "", -1)
 		prf := path.Join(*projects_dir, proj)
 		if f, err := os.OpenFile(prf, os.O_APPEND|os.O_WRONLY, 0600); err == nil {
-			project_attachments_dir = path.Join(*projects_dir, stripProjectSuffix(proj))
+			project_attachments_dir = journal.ProjectDir(*projects_dir, proj)
 			fmt.Fprintf(f, "\n=== %s ===\n%s\n", timestamp.Format("2006-01-02"), contents)
 			f.Close()
 		}
 	}
 	if project != "" {
-		contents = "@project " + formatProjectName(project) + "\n" + contents
+		contents = "@project " + journal.ProjectName(project) + "\n" + contents
+	}
+	if author != "" {
+		contents = fmt.Sprintf("%s\n@author %s", contents, author)
 	}
 
 	if *attachments_dir != "" {
@@ -343,29 +448,30 @@ func saveJournalEntry(timestamp time.Time, contents string, project string, atta
 		defer attachmentMutex.Unlock()
 
 		for _, att_hash := range attachmentIDs {
-			entry := attachments[att_hash]
-			delete(attachments, att_hash)
+			if _, ok := attachments[att_hash]; ok {
+				stored_hash, err := storeUpload(att_hash, author)
+				if err != nil {
+					nonFatalError = err
+					continue
+				}
+				att_hash = stored_hash
+			} else if stored_hash, ok := storedHash(att_hash); ok {
+				att_hash = stored_hash
+			} else {
+				// This can happen for drafts restored after a restart
+				nonFatalError = fmt.Errorf("attachment %s is no longer available", att_hash)
+				continue
+			}
+			stored := path.Join(*attachments_dir, att_hash)
 
 			// Link the attachment in the post body
 			contents = fmt.Sprintf("%s\n@attachment %s", contents, att_hash)
 
-			f, err := os.Create(path.Join(*attachments_dir, att_hash))
-			if err != nil {
-				nonFatalError = err
-				continue
-			}
-			f.Write(entry.Buf)
-			f.Close()
-
 			if project_attachments_dir != "" {
 				os.MkdirAll(project_attachments_dir, 0755)
-				f, err := os.Create(path.Join(project_attachments_dir, att_hash))
-				if err != nil {
+				if err := copyFile(stored, path.Join(project_attachments_dir, att_hash)); err != nil {
 					nonFatalError = err
-					continue
 				}
-				f.Write(entry.Buf)
-				f.Close()
 			}
 		}
 	}
@@ -376,40 +482,59 @@ func saveJournalEntry(timestamp time.Time, contents string, project string, atta
 		Contents: contents,
 	}
 
-	err := journal.Add(*journal_file, e)
+	err = journal.Add(filename, e)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nonFatalError
+	return e, nonFatalError
 }
 
-func SaveHandler(w http.ResponseWriter, r *http.Request) {
-	timestamp := journal.SmartTime(r.PostFormValue("ts"))
-	starred := r.PostFormValue("star") != ""
-	body := r.PostFormValue("body")
-	project := r.PostFormValue("project")
-	attachmentIDs := readAttachmentHashes(r)
-
+// prepareEntry cleans up the body of a new entry. Unless hasTimestamp is set,
+// the body may start with a jrnl-style date; a '*' at the end of the first
+// line stars the entry.
+func prepareEntry(timestamp time.Time, hasTimestamp bool, body string, starred bool) (time.Time, string, bool) {
 	// Remove carriage returns entirely. Why? Because it fits my use case, and because sod MS-DOS.
 	body = strings.Replace(body, "\r", "", -1)
 	for len(body) > 0 && body[len(body)-1] == '\n' {
 		body = body[0 : len(body)-1]
 	}
 
+	// Allow jrnl-style dates and stars in the body. An explicit timestamp takes precedence.
+	if !hasTimestamp {
+		if t, rest, ok := journal.InlineDate(body, time.Now()); ok {
+			timestamp, body = t, rest
+		}
+	}
+	if rest, ok := journal.InlineStar(body); ok {
+		body, starred = rest, true
+	}
+
+	return timestamp, body, starred
+}
+
+func SaveHandler(w http.ResponseWriter, r *http.Request) {
+	ts := r.PostFormValue("ts")
+	project := r.PostFormValue("project")
+	attachmentIDs := readAttachmentHashes(r)
+	timestamp, body, starred := prepareEntry(journal.SmartTime(ts), ts != "", r.PostFormValue("body"), r.PostFormValue("star") != "")
+
 	getv := r.URL.Query()
 	getv.Del("failure")
 	getv.Del("success")
 
-	err := saveJournalEntry(timestamp, body, project, attachmentIDs, starred)
+	user := loginName(r)
+	_, err := saveJournalEntry(timestamp, body, project, attachmentIDs, starred, user)
 	if err != nil {
-		log.Printf("error saving journal entry: %v", err)
+		log.Printf("error saving journal entry for user '%s': %v", user, err)
 		getv.Set("failure", "1")
 	} else {
 		getv.Set("success", "1")
 		if draft_id := r.PostFormValue("draft_id"); draft_id != "" {
 			// We've saved this post - no need to keep the draft around
 			draftsMutex.Lock()
-			delete(drafts, draft_id)
+			if d, ok := drafts[draft_id]; ok && d.ownedBy(user) {
+				forgetDraft(draft_id)
+			}
 			draftsMutex.Unlock()
 		}
 	}
@@ -420,31 +545,45 @@ func SaveHandler(w http.ResponseWriter, r *http.Request) {
 
 func SaveDraftHandler(w http.ResponseWriter, r *http.Request) {
 	draft_id := r.PostFormValue("draft_id")
-	if len(draft_id) != 12 {
+	if !validDraftID(draft_id) {
 		buf := make([]byte, 6)
 		_, err := rand.Read(buf)
 		if err != nil {
 			w.WriteHeader(500)
 			w.Write([]byte("Internal Server Error"))
+			return
 		}
 		draft_id = hex.EncodeToString(buf)
 	}
 
+	user := loginName(r)
 	post_body := r.PostFormValue("body")
 	project := r.PostFormValue("project")
 
 	draftsMutex.Lock()
 	defer draftsMutex.Unlock()
+	if d, ok := drafts[draft_id]; ok && !d.ownedBy(user) {
+		log.Printf("User '%s' tried to save draft ID %s by user '%s'", user, draft_id, d.Author)
+		writeJSONError(w, 403, 403, "Access denied")
+		return
+	}
 	if post_body == "" {
-		delete(drafts, draft_id)
+		forgetDraft(draft_id)
 	} else {
-		drafts[draft_id] = draftEntry{
+		entry := draftEntry{
 			LastEdit:      time.Now(),
 			Expires:       time.Now().Add(DraftTimeout),
+			Author:        user,
 			Body:          post_body,
 			Project:       project,
 			AttachmentIDs: readAttachmentHashes(r),
 		}
+		drafts[draft_id] = entry
+		if err := storeDraft(draft_id, entry); err != nil {
+			log.Printf("Error storing draft ID %s by user '%s': %v", draft_id, user, err)
+			writeJSONError(w, 500, 500, "Error saving draft")
+			return
+		}
 	}
 
 	writeJSON(w, struct {
@@ -470,26 +609,81 @@ func FileUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chunk, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Error reading chunk: %v")
+	var offset int64 = -1
+	if o := r.URL.Query().Get("offset"); o != "" {
+		var err error
+		offset, err = strconv.ParseInt(o, 10, 64)
+		if err != nil || offset < 0 {
+			writeJSONError(w, 400, 400, "Invalid offset")
+			return
+		}
+	}
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, *max_attachment_size))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, 413, 413, "Error reading chunk: "+errUploadTooLarge.Error())
+		return
+	} else if err != nil {
+		log.Printf("Error reading chunk: %v", err)
 		writeJSONError(w, 400, 400, "Error reading chunk")
 		return
 	}
 
+	user := loginName(r)
+
 	attachmentMutex.Lock()
+	e, err := receiveChunk(att_hash, user, offset, chunk)
+	_, pending := attachments[att_hash]
+	attachmentMutex.Unlock()
 
-	e := attachments[att_hash]
-	e.PurgeAt = time.Now().Add(AttachmentTimeout)
-	e.Buf = append(e.Buf, chunk...)
-	file_length := len(e.Buf)
-	attachments[att_hash] = e
+	if err != nil {
+		status := 500
+		message := "Error saving chunk"
+		if errors.Is(err, errUploadGap) || errors.Is(err, errUploadComplete) {
+			status, message = 409, "Error saving chunk: "+err.Error()
+		} else if errors.Is(err, errUploadTooLarge) {
+			status, message = 413, "Error saving chunk: "+err.Error()
+		} else if errors.Is(err, errQuotaExceeded) {
+			status, message = 507, "Error saving chunk: "+err.Error()
+		} else if errors.Is(err, errUploadNotYours) {
+			status, message = 403, "Error saving chunk: "+err.Error()
+		} else {
+			log.Printf("Error saving chunk for user '%s': %v", user, err)
+		}
 
-	attachmentMutex.Unlock()
+		// Include the length, so the client knows where to continue
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Error    int    `json:"error"`
+			Message  string `json:"_"`
+			OK       int    `json:"ok"`
+			Length   int64  `json:"file_length"`
+			Complete bool   `json:"complete"`
+		}{status, message, 0, e.Size, e.Complete})
+		return
+	}
+
+	message := "Chunk saved"
+	taken := ""
+	if e.Complete {
+		message = "Attachment complete"
 
+		// Suggest the time a photo was taken as the time of the entry
+		filename := path.Join(*attachments_dir, att_hash)
+		if pending {
+			filename = uploadPath(att_hash)
+		}
+		if t, ok := captureTime(filename); ok {
+			taken = t.Format("2006-01-02 15:04")
+		}
+	}
 	writeJSON(w, struct {
-		OK      int    `json:"ok"`
-		Message string `json:"_"`
-		Length  int    `json:"file_length"`
-	}{1, "Chunk saved", file_length})
+		OK       int    `json:"ok"`
+		Message  string `json:"_"`
+		Length   int64  `json:"file_length"`
+		Complete bool   `json:"complete"`
+		Taken    string `json:"taken,omitempty"`
+	}{1, message, e.Size, e.Complete, taken})
 }
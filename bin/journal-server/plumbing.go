@@ -2,13 +2,12 @@ package main
 
 import (
 	"encoding/json"
-	"flag"
 	"html/template"
 	"log"
 	"net/http"
-	"strings"
 
-	"github.com/gorilla/context"
+	"github.com/thijzert/go-journal"
+	"github.com/thijzert/go-journal/bin/journal-server/secretbookmark"
 )
 
 var index *template.Template
@@ -16,28 +15,11 @@ var editor *template.Template
 var daily *template.Template
 var bwvlist *template.Template
 var tie *template.Template
-
-func stripProjectSuffix(name string) string {
-	if len(name) > 4 && name[len(name)-4:] == ".txt" {
-		name = name[:len(name)-5]
-	} else if len(name) > 5 && name[len(name)-5:] == ".wiki" {
-		name = name[:len(name)-5]
-	}
-	return name
-}
-
-func formatProjectName(name string) string {
-	name = stripProjectSuffix(name)
-	name = strings.Replace(name, "_", " ", -1)
-
-	return name
-}
+var reader *template.Template
 
 func init() {
-	flag.Parse()
-
 	funcs := template.FuncMap{}
-	funcs["ProjectName"] = formatProjectName
+	funcs["ProjectName"] = journal.ProjectName
 
 	b, err := Asset("assets/templates/editor.html")
 	if err != nil {
@@ -75,6 +57,15 @@ func init() {
 		log.Fatal(err)
 	}
 
+	b, err = Asset("assets/templates/read.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	reader, err = template.New("reader").Funcs(funcs).Parse(string(b))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	b, err = Asset("assets/templates/tie.svg")
 	if err != nil {
 		log.Fatal(err)
@@ -87,8 +78,44 @@ func init() {
 
 func RequireLoggedIn(f func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		login := context.Get(r, "login")
-		if login == nil {
+		if _, ok := secretbookmark.User(r.Context(), secretbookmark.Write); !ok {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Access denied."))
+		} else {
+			f(w, r)
+		}
+	}
+}
+
+// loginName returns the name of the user who is logged in
+func loginName(r *http.Request) string {
+	user, _ := secretbookmark.User(r.Context(), secretbookmark.Write)
+	return user
+}
+
+// readerName returns the name of the user who is logged in to the read-only UI
+func readerName(r *http.Request) string {
+	user, _ := secretbookmark.User(r.Context(), secretbookmark.Read)
+	return user
+}
+
+// RequireCSRF checks the CSRF token of a form submitted in a session
+func RequireCSRF(f func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !secretbookmark.CheckCSRF(r, secretbookmark.Write) {
+			log.Printf("Refusing %s %s for user '%s': invalid CSRF token", r.Method, r.URL.Path, loginName(r))
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Access denied."))
+		} else {
+			f(w, r)
+		}
+	}
+}
+
+// RequireReader only allows access with the key for the read-only UI
+func RequireReader(f func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := secretbookmark.User(r.Context(), secretbookmark.Read); !ok {
 			w.WriteHeader(http.StatusForbidden)
 			w.Write([]byte("Access denied."))
 		} else {
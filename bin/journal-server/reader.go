@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/thijzert/go-journal"
+	"github.com/thijzert/go-journal/bin/journal-server/secretbookmark"
+)
+
+// ReaderMinKeyLength is the minimum length of a key for the read-only UI
+const ReaderMinKeyLength int = 24
+
+// ReaderDaysPerPage is the number of days shown on each page of the timeline
+const ReaderDaysPerPage int = 7
+
+// A readEntry is a journal entry, as shown in the read-only UI
+type readEntry struct {
+	*journal.Entry
+
+	// ID identifies the entry in permalinks
+	ID string
+
+	// Permalink is the URL to the entry's own page
+	Permalink template.URL
+
+	// Files lists the files attached to this entry
+	Files []readAttachment
+}
+
+// Body returns the contents of the entry after the title, without the lines
+// that link attachments
+func (e readEntry) Body() string {
+	if len(e.Files) == 0 {
+		return e.Entry.Body()
+	}
+
+	var lines []string
+	for _, l := range strings.Split(e.Entry.Body(), "\n") {
+		if !strings.HasPrefix(l, "@attachment ") {
+			lines = append(lines, l)
+		}
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// A readDay holds all entries on a single day
+type readDay struct {
+	Date    string
+	Entries []readEntry
+}
+
+// A readPage holds everything needed to render a page in the read-only UI
+type readPage struct {
+	Title string
+
+	// Root is the relative path to the root of the site
+	Root string
+
+	// KeyParameter is the URL parameter carrying the read key, and Key is
+	// its value. Over plain HTTP, every link in the read-only UI passes it
+	// on. Over HTTPS the key is exchanged for a session cookie, so Key is
+	// always empty.
+	KeyParameter, Key string
+}
+
+// Link returns the URL to a page in the read-only UI, relative to the root
+func (p readPage) Link(page string) template.URL {
+	return p.linkWith(page, url.Values{})
+}
+
+// linkWith returns the URL to a page in the read-only UI, with additional
+// URL parameters
+func (p readPage) linkWith(page string, v url.Values) template.URL {
+	if p.Key != "" {
+		v.Set(p.KeyParameter, p.Key)
+	}
+	if len(v) == 0 {
+		return template.URL(p.Root + page)
+	}
+	return template.URL(p.Root + page + "?" + v.Encode())
+}
+
+// Asset returns the URL to a static asset
+func (p readPage) Asset(name string) string {
+	return p.Root + "assets/" + name
+}
+
+// linkEntries sets the permalinks of all entries on these days, and links
+// their attachments
+func (p readPage) linkEntries(days ...*readDay) {
+	for _, d := range days {
+		for i, e := range d.Entries {
+			d.Entries[i].Permalink = p.Link("journal/read/entry/" + e.ID)
+
+			if *attachments_dir == "" {
+				continue
+			}
+			for _, att_hash := range e.Attachments() {
+				ctype, err := attachmentType(att_hash)
+				if err != nil {
+					continue
+				}
+				file := readAttachment{
+					Hash:  att_hash,
+					URL:   p.Link("journal/attachment/" + att_hash),
+					Image: strings.HasPrefix(ctype, "image/") && isInlineType(ctype),
+				}
+				if ctype == "image/jpeg" || ctype == "image/png" || ctype == "image/gif" {
+					file.Thumbnail = p.Link("journal/attachment/" + att_hash + "/thumbnail")
+				}
+				d.Entries[i].Files = append(d.Entries[i].Files, file)
+			}
+		}
+	}
+}
+
+func newReadPage(r *http.Request, title, root string) readPage {
+	rv := readPage{
+		Title:        title,
+		Root:         root,
+		KeyParameter: *read_parameter,
+	}
+	if !secretbookmark.IsHTTPS(r) {
+		rv.Key = r.URL.Query().Get(*read_parameter)
+	}
+	return rv
+}
+
+// entryID returns the permalink ID of an entry. Entries are identified by
+// their date; the nth entry in the same minute gets the suffix "-n".
+func entryID(e *journal.Entry, n int) string {
+	id := e.Date.Format("200601021504")
+	if n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// readJournal reads all entries in a user's journal matching q, and groups
+// them per day. The days are in the order of the journal file.
+func readJournal(user string, q journal.Query) ([]*readDay, error) {
+	filename, err := journalFile(user)
+	if err != nil {
+		return nil, err
+	}
+	c, err := journal.Find(filename, journal.Query{})
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing was written yet
+		log.Printf("Journal file '%s' does not exist; showing an empty journal", filename)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rv []*readDay
+	days := make(map[string]*readDay)
+	perMinute := make(map[string]int)
+	for e := range c {
+		// Number entries in the whole journal, so IDs don't depend on the query
+		minute := e.Date.Format("200601021504")
+		perMinute[minute]++
+		if !q.Match(e) {
+			continue
+		}
+
+		date := e.Date.Format("2006-01-02")
+		d := days[date]
+		if d == nil {
+			d = &readDay{Date: date}
+			days[date] = d
+			rv = append(rv, d)
+		}
+		d.Entries = append(d.Entries, readEntry{Entry: e, ID: entryID(e, perMinute[minute])})
+	}
+	return rv, nil
+}
+
+// readerError logs an error, and shows a generic error page that doesn't
+// reveal anything about the server
+func readerError(err error, w http.ResponseWriter) {
+	log.Printf("Error reading journal: %v", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("Error reading journal."))
+}
+
+// setReaderHeaders makes sure pages in the read-only UI don't end up in a
+// cache, or leak the key through the Referer header
+func setReaderHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+}
+
+// ReadHandler shows the timeline: the most recent days, newest first. Older
+// days are reached through the 'before' parameter.
+func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	setReaderHeaders(w)
+
+	terms := strings.TrimSpace(r.URL.Query().Get("q"))
+	q := journal.Query{
+		Terms: strings.Fields(terms),
+		Folding: journal.Folding{
+			IgnoreCase:    true,
+			IgnoreAccents: true,
+		},
+	}
+	before := r.URL.Query().Get("before")
+
+	days, err := readJournal(readerName(r), q)
+	if err != nil {
+		readerError(err, w)
+		return
+	}
+
+	end := len(days)
+	if before != "" {
+		for end > 0 && days[end-1].Date >= before {
+			end--
+		}
+	}
+	start := end - ReaderDaysPerPage
+	if start < 0 {
+		start = 0
+	}
+
+	pageData := struct {
+		readPage
+		Query string
+		Days  []*readDay
+		// Older and Newer link to the next and previous pages
+		Older, Newer template.URL
+	}{
+		readPage: newReadPage(r, "Journal", "../"),
+		Query:    terms,
+	}
+	for i := end - 1; i >= start; i-- {
+		pageData.Days = append(pageData.Days, days[i])
+	}
+
+	pager := func(before string) template.URL {
+		v := url.Values{}
+		if before != "" {
+			v.Set("before", before)
+		}
+		if terms != "" {
+			v.Set("q", terms)
+		}
+		return pageData.linkWith("journal/read", v)
+	}
+	if start > 0 {
+		pageData.Older = pager(days[start].Date)
+	}
+	if end+ReaderDaysPerPage < len(days) {
+		pageData.Newer = pager(days[end+ReaderDaysPerPage].Date)
+	} else if end < len(days) {
+		pageData.Newer = pager("")
+	}
+	pageData.linkEntries(pageData.Days...)
+
+	executeTemplate(reader.Lookup("timeline"), pageData, w, r)
+}
+
+// ReadDayHandler shows all entries on a single day
+func ReadDayHandler(w http.ResponseWriter, r *http.Request) {
+	setReaderHeaders(w)
+
+	date := mux.Vars(r)["date"]
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	days, err := readJournal(readerName(r), journal.Query{})
+	if err != nil {
+		readerError(err, w)
+		return
+	}
+
+	pageData := struct {
+		readPage
+		Day        *readDay
+		Prev, Next string
+	}{
+		readPage: newReadPage(r, date, "../../"),
+		Day:      &readDay{Date: date},
+	}
+	for i, d := range days {
+		if d.Date < date {
+			if d.Date > pageData.Prev {
+				pageData.Prev = d.Date
+			}
+		} else if d.Date == date {
+			pageData.Day = days[i]
+		} else if pageData.Next == "" || d.Date < pageData.Next {
+			pageData.Next = d.Date
+		}
+	}
+
+	pageData.linkEntries(pageData.Day)
+
+	executeTemplate(reader.Lookup("day"), pageData, w, r)
+}
+
+// ReadEntryHandler shows a single entry
+func ReadEntryHandler(w http.ResponseWriter, r *http.Request) {
+	setReaderHeaders(w)
+
+	id := mux.Vars(r)["id"]
+	days, err := readJournal(readerName(r), journal.Query{})
+	if err != nil {
+		readerError(err, w)
+		return
+	}
+
+	for _, d := range days {
+		for _, e := range d.Entries {
+			if e.ID != id {
+				continue
+			}
+
+			pageData := struct {
+				readPage
+				Day *readDay
+			}{
+				readPage: newReadPage(r, e.Date.Format("2006-01-02 15:04"), "../../../"),
+				Day:      &readDay{Date: d.Date, Entries: []readEntry{e}},
+			}
+			pageData.linkEntries(pageData.Day)
+
+			executeTemplate(reader.Lookup("entry_page"), pageData, w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
@@ -0,0 +1,175 @@
+package secretbookmark
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// An htpasswdEntry is a single user in an Apache htpasswd file
+type htpasswdEntry struct {
+	user string
+	hash []byte
+}
+
+// parseHtpasswd reads the users in an htpasswd file. Lines that can't be used
+// are skipped; the error lists all of them, with their line numbers.
+func parseHtpasswd(r io.Reader) ([]htpasswdEntry, error) {
+	var rv []htpasswdEntry
+	var errs []error
+
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i <= 0 {
+			errs = append(errs, fmt.Errorf("line %d: expected 'user:hash'", n))
+			continue
+		}
+		user, phash := string(line[:i]), line[i+1:]
+		if !supportedHash(phash) {
+			errs = append(errs, fmt.Errorf("line %d: unknown password hash format for user '%s'", n, user))
+			continue
+		}
+
+		rv = append(rv, htpasswdEntry{user, append([]byte(nil), phash...)})
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return rv, errors.Join(errs...)
+}
+
+// supportedHash checks if a password hash is in a format verifyHash knows
+func supportedHash(phash []byte) bool {
+	if isBcrypt(phash) {
+		_, err := bcrypt.Cost(phash)
+		return err == nil
+	}
+	if bytes.HasPrefix(phash, []byte("$apr1$")) {
+		return bytes.Count(phash, []byte("$")) == 3
+	}
+	if bytes.HasPrefix(phash, []byte("{SHA}")) {
+		b, err := base64.StdEncoding.DecodeString(string(phash[5:]))
+		return err == nil && len(b) == sha1.Size
+	}
+	return false
+}
+
+func isBcrypt(phash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(phash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyHash checks passkey against a hash from an htpasswd file
+func verifyHash(phash, passkey []byte) bool {
+	if isBcrypt(phash) {
+		return bcrypt.CompareHashAndPassword(phash, passkey) == nil
+	}
+	if bytes.HasPrefix(phash, []byte("$apr1$")) {
+		salt := bytes.SplitN(phash[6:], []byte("$"), 2)[0]
+		return subtle.ConstantTimeCompare(apr1(passkey, salt), phash) == 1
+	}
+	if bytes.HasPrefix(phash, []byte("{SHA}")) {
+		sum := sha1.Sum(passkey)
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), phash) == 1
+	}
+	return false
+}
+
+// apr1Alphabet is the alphabet used to encode APR1 hashes
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1 computes Apache's variant of the MD5-based crypt(3) hash, in the
+// format '$apr1$salt$hash'
+func apr1(password, salt []byte) []byte {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	const magic = "$apr1$"
+
+	h := md5.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	alt := h.Sum(nil)
+
+	h = md5.New()
+	h.Write(password)
+	h.Write([]byte(magic))
+	h.Write(salt)
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(alt)
+		} else {
+			h.Write(alt[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(password[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	// Make it slow
+	for i := 0; i < 1000; i++ {
+		h = md5.New()
+		if i&1 == 1 {
+			h.Write(password)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write(salt)
+		}
+		if i%7 != 0 {
+			h.Write(password)
+		}
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write(password)
+		}
+		sum = h.Sum(nil)
+	}
+
+	rv := append([]byte(magic), salt...)
+	rv = append(rv, '$')
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			rv = append(rv, apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(sum[0], sum[6], sum[12], 4)
+	encode(sum[1], sum[7], sum[13], 4)
+	encode(sum[2], sum[8], sum[14], 4)
+	encode(sum[3], sum[9], sum[15], 4)
+	encode(sum[4], sum[10], sum[5], 4)
+	encode(0, 0, sum[11], 2)
+	return rv
+}
@@ -0,0 +1,87 @@
+package secretbookmark
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestApr1(t *testing.T) {
+	cases := []struct {
+		password, salt, want string
+	}{
+		{"myPassword", "r31.....", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"},
+		{"apr-password", "abcdefgh", "$apr1$abcdefgh$wEOL5Cf4Yvkbx3Yl9AcCq/"},
+		{"", "xy", "$apr1$xy$43..WIhbfuznGvwoCyUek/"},
+		{"a-password-that-is-longer-than-sixteen-bytes", "longsalt", "$apr1$longsalt$a0B5GOVLvUSWZAj4MPELf1"},
+
+		// Only the first 8 characters of the salt are used
+		{"apr-password", "abcdefghijkl", "$apr1$abcdefgh$wEOL5Cf4Yvkbx3Yl9AcCq/"},
+	}
+
+	for _, c := range cases {
+		if got := string(apr1([]byte(c.password), []byte(c.salt))); got != c.want {
+			t.Errorf("apr1(%q, %q) = %q, want %q", c.password, c.salt, got, c.want)
+		}
+	}
+}
+
+func TestSupportedHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		hash string
+		want bool
+	}{
+		{string(bcryptHash), true},
+		{"$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", true},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", true},
+		{"{SHA}MNLW6wfRtawHZ/atRhQOJCUt398=", true},
+
+		{"$2y$10$tooshort", false},
+		{"$apr1$r31.....", false},
+		{"$apr1$r31.....$Hq$JZ", false},
+		{"{SHA}not base64!", false},
+		{"{SHA}" + "AAAA", false},
+		{"$1$saltsalt$md5cryptisnotsupported", false},
+		{"plaintext", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if got := supportedHash([]byte(c.hash)); got != c.want {
+			t.Errorf("supportedHash(%q) = %v, want %v", c.hash, got, c.want)
+		}
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		hash, password string
+		want           bool
+	}{
+		{string(bcryptHash), "bcrypt-password", true},
+		{string(bcryptHash), "bcrypt-passwort", false},
+		{"$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "myPassword", true},
+		{"$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "mypassword", false},
+		{"$apr1$abcdefgh$wEOL5Cf4Yvkbx3Yl9AcCq/", "apr-password", true},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password", true},
+		{"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "Password", false},
+		{"{SHA}MNLW6wfRtawHZ/atRhQOJCUt398=", "sha-password", true},
+		{"plaintext", "plaintext", false},
+	}
+
+	for _, c := range cases {
+		if got := verifyHash([]byte(c.hash), []byte(c.password)); got != c.want {
+			t.Errorf("verifyHash(%q, %q) = %v, want %v", c.hash, c.password, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package secretbookmark
+
+import (
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Checking a key against the password file is slow on purpose, and so is
+// guessing keys. To keep it that way, the number of keys checked is limited
+// per IP address and overall, and IP addresses that keep guessing wrong are
+// locked out for a while. Recently verified keys are cached, so users with a
+// valid key don't notice any of this, even while the server is under attack.
+
+const (
+	// IPAttempts is the number of keys an IP address may try in a burst,
+	// and IPAttemptInterval is the time after which it may try one more
+	IPAttempts        int           = 10
+	IPAttemptInterval time.Duration = 6 * time.Second
+
+	// GlobalAttempts is the number of keys that may be tried in a burst by
+	// all IP addresses combined, and GlobalAttemptInterval is the time
+	// after which one more may be tried
+	GlobalAttempts        int           = 20
+	GlobalAttemptInterval time.Duration = 500 * time.Millisecond
+
+	// MaxFailures is the number of wrong keys an IP address may try before
+	// it is locked out
+	MaxFailures int = 5
+
+	// LockoutTime is how long an IP address is locked out after MaxFailures
+	// wrong keys. It doubles with every wrong key after that, up to
+	// MaxLockoutTime.
+	LockoutTime    time.Duration = time.Minute
+	MaxLockoutTime time.Duration = 24 * time.Hour
+
+	// FailureMemory is how long wrong keys are remembered
+	FailureMemory time.Duration = 24 * time.Hour
+
+	// VerifiedKeyTTL is how long a verified key is cached
+	VerifiedKeyTTL time.Duration = 15 * time.Minute
+)
+
+// A bucket holds the attempts left in a burst. It is refilled at a fixed rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes one token from the bucket, if it has any. If not, it returns
+// the time until the next token is available.
+func (b *bucket) take(now time.Time, burst int, interval time.Duration) (time.Duration, bool) {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += float64(now.Sub(b.last)) / float64(interval)
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(interval)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// An ipState is what the limiter knows about a single IP address
+type ipState struct {
+	attempts    bucket
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// A limiter keeps track of the keys tried by each IP address. The write and
+// read bookmarks share one, so they also share the global limit.
+type limiter struct {
+	mu        sync.Mutex
+	global    bucket
+	ips       map[string]*ipState
+	lastPrune time.Time
+	lockouts  *log.Logger
+
+	// now returns the current time
+	now func() time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{ips: make(map[string]*ipState), now: time.Now}
+}
+
+// clientIP returns the IP address of a client, given the remote address of
+// its connection. IPv6 clients are grouped per /64 network, since that's
+// what a single client usually gets.
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip.String()
+}
+
+// locked checks if an IP address is locked out. If so, it returns the time
+// until the lockout ends.
+func (l *limiter) locked(ip string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := l.ips[ip]
+	if st == nil {
+		return 0, false
+	}
+	if wait := st.lockedUntil.Sub(l.now()); wait > 0 {
+		return wait, true
+	}
+	return 0, false
+}
+
+// allow checks if an IP address may try another key. If not, it returns the
+// time until it may.
+func (l *limiter) allow(ip string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	st := l.state(ip)
+	if wait := st.lockedUntil.Sub(now); wait > 0 {
+		return wait, false
+	}
+	if wait, ok := st.attempts.take(now, IPAttempts, IPAttemptInterval); !ok {
+		return wait, false
+	}
+	if wait, ok := l.global.take(now, GlobalAttempts, GlobalAttemptInterval); !ok {
+		return wait, false
+	}
+	return 0, true
+}
+
+// fail records a wrong key, and locks out the IP address if it has tried too
+// many
+func (l *limiter) fail(ip, parameterName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	st := l.state(ip)
+	if now.Sub(st.lastFailure) > FailureMemory {
+		st.failures = 0
+	}
+	st.failures++
+	st.lastFailure = now
+
+	if st.failures < MaxFailures {
+		return
+	}
+	lockout := MaxLockoutTime
+	if exp := st.failures - MaxFailures; exp < 32 {
+		lockout = time.Duration(math.Min(float64(LockoutTime)*math.Pow(2, float64(exp)), float64(MaxLockoutTime)))
+	}
+	st.lockedUntil = now.Add(lockout)
+
+	log.Printf("Locking out %s for %s after %d wrong keys in %s", ip, lockout, st.failures, parameterName)
+	if l.lockouts != nil {
+		l.lockouts.Printf("%s locked out for %s after %d wrong keys in %s", ip, lockout, st.failures, parameterName)
+	}
+}
+
+// succeed forgets about the wrong keys an IP address tried earlier
+func (l *limiter) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if st := l.ips[ip]; st != nil {
+		st.failures = 0
+	}
+}
+
+// state returns the state of an IP address. The caller should hold l.mu.
+func (l *limiter) state(ip string) *ipState {
+	now := l.now()
+	if now.Sub(l.lastPrune) > time.Minute {
+		l.prune(now)
+	}
+
+	st := l.ips[ip]
+	if st == nil {
+		st = &ipState{}
+		l.ips[ip] = st
+	}
+	return st
+}
+
+// prune removes the IP addresses there's nothing left to remember about. The
+// caller should hold l.mu.
+func (l *limiter) prune(now time.Time) {
+	l.lastPrune = now
+	for ip, st := range l.ips {
+		refilled := now.Sub(st.attempts.last) > time.Duration(IPAttempts)*IPAttemptInterval
+		forgiven := st.failures == 0 || now.Sub(st.lastFailure) > FailureMemory
+		if refilled && forgiven && now.After(st.lockedUntil) {
+			delete(l.ips, ip)
+		}
+	}
+}
+
+// LogLockouts writes a line to w whenever an IP address is locked out, e.g.
+// for use with fail2ban. The log is shared with all SecretBookmarks derived
+// from this one.
+func (s *SecretBookmark) LogLockouts(w io.Writer) {
+	s.limiter.mu.Lock()
+	defer s.limiter.mu.Unlock()
+	s.limiter.lockouts = log.New(w, "", log.LstdFlags)
+}
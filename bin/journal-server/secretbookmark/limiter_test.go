@@ -0,0 +1,183 @@
+package secretbookmark
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestLimiter() (*limiter, *fakeClock) {
+	clock := &fakeClock{time.Date(2023, 2, 1, 15, 16, 0, 0, time.UTC)}
+	l := newLimiter()
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLimiterLockout(t *testing.T) {
+	cases := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{1, 0},
+		{MaxFailures - 1, 0},
+		{MaxFailures, LockoutTime},
+		{MaxFailures + 1, 2 * LockoutTime},
+		{MaxFailures + 2, 4 * LockoutTime},
+		{MaxFailures + 10, 1024 * LockoutTime},
+		{MaxFailures + 11, MaxLockoutTime},
+		{MaxFailures + 100, MaxLockoutTime},
+	}
+
+	for _, c := range cases {
+		l, _ := newTestLimiter()
+		for i := 0; i < c.failures; i++ {
+			l.fail("192.0.2.1", "apikey")
+		}
+
+		wait, locked := l.locked("192.0.2.1")
+		if locked != (c.wait > 0) || wait != c.wait {
+			t.Errorf("after %d failures: locked = %v for %s, want %s", c.failures, locked, wait, c.wait)
+		}
+		if _, locked := l.locked("192.0.2.2"); locked {
+			t.Errorf("after %d failures: another IP address is locked out too", c.failures)
+		}
+		if _, ok := l.allow("192.0.2.1"); ok == (c.wait > 0) {
+			t.Errorf("after %d failures: allow = %v", c.failures, ok)
+		}
+	}
+}
+
+func TestLimiterExpiry(t *testing.T) {
+	cases := []struct {
+		name string
+
+		// failures are the wrong keys tried before waiting for wait. If
+		// again is set, one more wrong key is tried after that.
+		failures int
+		succeed  bool
+		wait     time.Duration
+		again    bool
+
+		locked    bool
+		remaining time.Duration
+	}{
+		{"lockout ends", MaxFailures, false, LockoutTime, false, false, 0},
+		{"lockout continues", MaxFailures, false, LockoutTime - time.Second, false, true, time.Second},
+		{"failure after lockout", MaxFailures, false, LockoutTime, true, true, 2 * LockoutTime},
+		{"failures remembered", MaxFailures - 1, false, FailureMemory, true, true, LockoutTime},
+		{"failures forgotten", MaxFailures - 1, false, FailureMemory + time.Second, true, false, 0},
+		{"lockouts forgotten", MaxFailures + 3, false, FailureMemory + time.Second, true, false, 0},
+		{"success forgives", MaxFailures - 1, true, 0, true, false, 0},
+	}
+
+	for _, c := range cases {
+		l, clock := newTestLimiter()
+		for i := 0; i < c.failures; i++ {
+			l.fail("192.0.2.1", "apikey")
+		}
+		if c.succeed {
+			l.succeed("192.0.2.1")
+		}
+		clock.advance(c.wait)
+
+		if c.again {
+			l.fail("192.0.2.1", "apikey")
+		}
+
+		remaining, locked := l.locked("192.0.2.1")
+		if locked != c.locked || remaining != c.remaining {
+			t.Errorf("%s: locked = %v for %s, want %v for %s", c.name, locked, remaining, c.locked, c.remaining)
+		}
+	}
+}
+
+func TestLimiterAttempts(t *testing.T) {
+	l, clock := newTestLimiter()
+
+	for i := 0; i < IPAttempts; i++ {
+		if _, ok := l.allow("192.0.2.1"); !ok {
+			t.Fatalf("attempt %d was refused", i+1)
+		}
+	}
+	wait, ok := l.allow("192.0.2.1")
+	if ok || wait != IPAttemptInterval {
+		t.Errorf("attempt %d: allow = %v, %s; want false, %s", IPAttempts+1, ok, wait, IPAttemptInterval)
+	}
+
+	clock.advance(IPAttemptInterval)
+	if _, ok := l.allow("192.0.2.1"); !ok {
+		t.Errorf("attempt was refused after waiting %s", IPAttemptInterval)
+	}
+	if _, ok := l.allow("192.0.2.1"); ok {
+		t.Errorf("two attempts allowed after waiting %s", IPAttemptInterval)
+	}
+
+	// The remaining attempts are shared by all IP addresses
+	clock.advance(time.Duration(GlobalAttempts) * GlobalAttemptInterval)
+	for i := 0; i < GlobalAttempts; i++ {
+		ip := fmt.Sprintf("198.51.100.%d", i)
+		if _, ok := l.allow(ip); !ok {
+			t.Fatalf("attempt from %s was refused", ip)
+		}
+	}
+	wait, ok = l.allow("203.0.113.1")
+	if ok || wait != GlobalAttemptInterval {
+		t.Errorf("attempt %d overall: allow = %v, %s; want false, %s", GlobalAttempts+1, ok, wait, GlobalAttemptInterval)
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l, clock := newTestLimiter()
+	for i := 0; i < MaxFailures; i++ {
+		l.allow("192.0.2.1")
+		l.fail("192.0.2.1", "apikey")
+	}
+	l.allow("192.0.2.2")
+
+	clock.advance(2 * time.Minute)
+	l.allow("192.0.2.3")
+	if _, ok := l.ips["192.0.2.1"]; !ok {
+		t.Errorf("a locked out IP address was forgotten")
+	}
+	if _, ok := l.ips["192.0.2.2"]; ok {
+		t.Errorf("an IP address with nothing to remember was kept")
+	}
+
+	clock.advance(FailureMemory + time.Second)
+	l.allow("192.0.2.3")
+	if _, ok := l.ips["192.0.2.1"]; ok {
+		t.Errorf("a forgiven IP address was kept")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		remoteAddr, want string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"[2001:db8:1:2:3:4:5:6]:1234", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2:ffff::1]:1234", "2001:db8:1:2::/64"},
+		{"[::ffff:192.0.2.1]:1234", "192.0.2.1"},
+		{"not an address", "not an address"},
+	}
+
+	for _, c := range cases {
+		if got := clientIP(c.remoteAddr); got != c.want {
+			t.Errorf("clientIP(%q) = %q, want %q", c.remoteAddr, got, c.want)
+		}
+	}
+}
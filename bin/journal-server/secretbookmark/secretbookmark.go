@@ -1,19 +1,70 @@
 package secretbookmark
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Permission is what a secret bookmark grants access to
+type Permission int
+
+const (
+	// Write allows adding entries to the journal
+	Write Permission = iota
 
-	"github.com/gorilla/context"
-	"golang.org/x/crypto/bcrypt"
+	// Read allows reading the journal
+	Read
 )
 
+// contextKey is the key under which the user name is stored in the request
+// context, for each permission
+type contextKey Permission
+
+// User returns the name of the user who was granted permission p, if any
+func User(ctx context.Context, p Permission) (string, bool) {
+	user, ok := ctx.Value(contextKey(p)).(string)
+	return user, ok
+}
+
 type SecretBookmark struct {
 	parameterName string
 	passwordFile  string
+	permission    Permission
+	minLength     int
+	weaker        *SecretBookmark
+
+	limiter *limiter
+
+	// The parsed password file, and the version of the file it was read
+	// from. It is read again whenever the file changes, and generation is
+	// incremented.
+	mu         sync.Mutex
+	users      []htpasswdEntry
+	modTime    time.Time
+	size       int64
+	generation int
+
+	// verified caches the keys that were recently found to be valid
+	verified map[[sha256.Size]byte]verifiedKey
+
+	// sessions holds the sessions started with this bookmark, by ID
+	sessions map[string]session
+}
+
+// A verifiedKey is a key that was found to be valid, and the generations of
+// the password files it was checked against
+type verifiedKey struct {
+	user             string
+	expires          time.Time
+	generation       int
+	weakerGeneration int
 }
 
 func New(parameterName, passwordFile string) *SecretBookmark {
@@ -23,50 +74,220 @@ func New(parameterName, passwordFile string) *SecretBookmark {
 	if passwordFile == "" {
 		passwordFile = ".htpasswd"
 	}
-	return &SecretBookmark{parameterName, passwordFile}
+	return &SecretBookmark{
+		parameterName: parameterName,
+		passwordFile:  passwordFile,
+		permission:    Write,
+		limiter:       newLimiter(),
+	}
 }
 
-func (s *SecretBookmark) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer next.ServeHTTP(w, r)
+// NewStrong creates a SecretBookmark for a credential that is stronger than
+// the one checked by weaker. Keys shorter than minLength are refused, as are
+// keys that are also valid for weaker; this way, leaking a weaker bookmark
+// never grants access to whatever the stronger one protects. Both share the
+// same limits on guessing keys.
+func NewStrong(parameterName, passwordFile string, permission Permission, minLength int, weaker *SecretBookmark) *SecretBookmark {
+	return &SecretBookmark{
+		parameterName: parameterName,
+		passwordFile:  passwordFile,
+		permission:    permission,
+		minLength:     minLength,
+		weaker:        weaker,
+		limiter:       weaker.limiter,
+	}
+}
 
-		passkey := []byte(r.URL.Query().Get(s.parameterName))
-		if len(passkey) == 0 {
-			return
+// Validate reads the password file, and returns an error if it can't be read,
+// contains lines that can't be used, or has no users at all
+func (s *SecretBookmark) Validate() error {
+	f, err := os.Open(s.passwordFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	users, err := parseHtpasswd(f)
+	if err != nil {
+		return fmt.Errorf("password file %s: %w", s.passwordFile, err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("password file %s has no users", s.passwordFile)
+	}
+	for _, u := range users {
+		if !isBcrypt(u.hash) {
+			log.Printf("Warning: user '%s' in %s has a weak password hash; consider using bcrypt", u.user, s.passwordFile)
 		}
-		// TODO: check passkey for validity.
-		// TODO: store some sort of a username in the context
+	}
+	return nil
+}
 
-		pwds, err := os.Open(s.passwordFile)
-		if err != nil {
-			log.Printf("Error opening password file %s: %s", s.passwordFile, err)
-			return
+// load returns the users in the password file, reading it again if it has
+// changed since the last time. Whenever that happens, the cache of verified
+// keys is cleared.
+func (s *SecretBookmark) load() ([]htpasswdEntry, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi, err := os.Stat(s.passwordFile)
+	if err != nil {
+		log.Printf("Error opening password file %s: %s", s.passwordFile, err)
+		if s.users != nil {
+			s.users, s.modTime, s.size, s.verified = nil, time.Time{}, 0, nil
+			s.generation++
 		}
+		return nil, s.generation
+	}
+	if s.users != nil && fi.ModTime().Equal(s.modTime) && fi.Size() == s.size {
+		return s.users, s.generation
+	}
 
-		pwdr := bufio.NewReader(pwds)
-		var line, user, phash []byte
-		for ; err == nil; line, _, err = pwdr.ReadLine() {
-			if len(line) < 3 || line[0] == '#' {
-				continue
-			}
+	f, err := os.Open(s.passwordFile)
+	if err != nil {
+		log.Printf("Error opening password file %s: %s", s.passwordFile, err)
+		return nil, s.generation
+	}
+	defer f.Close()
 
-			for i, c := range line {
-				if c == ':' {
-					user = line[:i]
-					phash = line[i+1:]
-					break
-				}
-			}
+	users, err := parseHtpasswd(f)
+	if err != nil {
+		log.Printf("Error reading password file %s: %s", s.passwordFile, err)
+	}
+	if users == nil {
+		users = []htpasswdEntry{}
+	}
+	s.users, s.modTime, s.size, s.verified = users, fi.ModTime(), fi.Size(), nil
+	s.generation++
+	return users, s.generation
+}
 
-			if len(phash) > 5 && bytes.Equal(phash[0:4], []byte("$2y$")) {
-				// Verify Bcrypt
-				if err = bcrypt.CompareHashAndPassword(phash, passkey); err == nil {
-					context.Set(r, "login", string(user))
-					return
-				}
+// generations returns the current versions of this bookmark's password file,
+// and that of the weaker one
+func (s *SecretBookmark) generations() (int, int) {
+	_, gen := s.load()
+	weakerGen := 0
+	if s.weaker != nil {
+		_, weakerGen = s.weaker.load()
+	}
+	return gen, weakerGen
+}
+
+// cached looks up a key in the cache of verified keys
+func (s *SecretBookmark) cached(passkey []byte) (string, bool) {
+	gen, weakerGen := s.generations()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.verified[sha256.Sum256(passkey)]
+	if !ok || time.Now().After(v.expires) || v.generation != gen || v.weakerGeneration != weakerGen {
+		return "", false
+	}
+	return v.user, true
+}
+
+// remember adds a key to the cache of verified keys. The generations should
+// be those from before the key was checked.
+func (s *SecretBookmark) remember(passkey []byte, user string, gen, weakerGen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.verified == nil {
+		s.verified = make(map[[sha256.Size]byte]verifiedKey)
+	}
+	for k, v := range s.verified {
+		if now.After(v.expires) {
+			delete(s.verified, k)
+		}
+	}
+	s.verified[sha256.Sum256(passkey)] = verifiedKey{user, now.Add(VerifiedKeyTTL), gen, weakerGen}
+}
+
+func (s *SecretBookmark) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, wait, ok := s.authenticate(r)
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("Too many attempts. Try again later."))
+			return
+		}
+		if ok && wantsSession(r) {
+			if err := s.startSession(w, user); err != nil {
+				log.Printf("Error starting session for user '%s': %v", user, err)
 			} else {
-				log.Printf("Unknown password hash format '%s'", phash)
+				// Keep the URL relative, in case we're behind a reverse proxy
+				w.Header().Set("Location", s.withoutKey(r))
+				w.WriteHeader(http.StatusSeeOther)
+				return
 			}
 		}
+
+		ctx := r.Context()
+		if ok {
+			ctx = context.WithValue(ctx, contextKey(s.permission), user)
+		} else if sess, ok := s.session(r); ok {
+			ctx = context.WithValue(ctx, contextKey(s.permission), sess.user)
+			ctx = context.WithValue(ctx, csrfKey(s.permission), sess.csrfToken)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticate checks the key in the request, and returns the user it belongs
+// to. If the client has tried too many keys, it returns the time it should
+// wait before trying again.
+func (s *SecretBookmark) authenticate(r *http.Request) (string, time.Duration, bool) {
+	passkey := []byte(r.URL.Query().Get(s.parameterName))
+	if len(passkey) == 0 {
+		return "", 0, false
+	}
+	if len(passkey) < s.minLength {
+		log.Printf("Refusing %s: key is shorter than %d characters", s.parameterName, s.minLength)
+		return "", 0, false
+	}
+
+	// Keys that were verified recently are accepted even from an IP address
+	// that is locked out, as it may be shared with whoever is guessing keys
+	if user, ok := s.cached(passkey); ok {
+		return user, 0, true
+	}
+	ip := clientIP(r.RemoteAddr)
+	if wait, locked := s.limiter.locked(ip); locked {
+		return "", wait, false
+	}
+	if wait, ok := s.limiter.allow(ip); !ok {
+		log.Printf("Refusing %s from %s: too many attempts", s.parameterName, ip)
+		return "", wait, false
+	}
+
+	gen, weakerGen := s.generations()
+	user, ok := s.check(passkey)
+	if !ok {
+		s.limiter.fail(ip, s.parameterName)
+		return "", 0, false
+	}
+	if s.weaker != nil {
+		if _, ok := s.weaker.check(passkey); ok {
+			log.Printf("Refusing %s for user '%s': the same key is accepted as %s", s.parameterName, user, s.weaker.parameterName)
+			return "", 0, false
+		}
+	}
+
+	s.limiter.succeed(ip)
+	s.remember(passkey, user, gen, weakerGen)
+	return user, 0, true
+}
+
+// check looks up passkey in the password file, and returns the user it
+// belongs to
+func (s *SecretBookmark) check(passkey []byte) (string, bool) {
+	users, _ := s.load()
+	for _, u := range users {
+		if verifyHash(u.hash, passkey) {
+			return u.user, true
+		}
+	}
+	return "", false
+}
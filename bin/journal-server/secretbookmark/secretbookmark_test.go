@@ -0,0 +1,55 @@
+package secretbookmark
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testHtpasswd has the users alice, with password 'password', and bob, with
+// password 'sha-password'
+const testHtpasswd = "alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nbob:{SHA}MNLW6wfRtawHZ/atRhQOJCUt398=\n"
+
+func TestAuthenticateLockedOut(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), ".htpasswd")
+	if err := os.WriteFile(passwordFile, []byte(testHtpasswd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := New("apikey", passwordFile)
+	l, _ := newTestLimiter()
+	s.limiter = l
+
+	authenticate := func(key string) (string, bool, bool) {
+		r := httptest.NewRequest("GET", "/journal?apikey="+key, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		user, wait, ok := s.authenticate(r)
+		return user, wait > 0, ok
+	}
+
+	if user, _, ok := authenticate("password"); !ok || user != "alice" {
+		t.Fatalf("valid key refused before the lockout")
+	}
+	for i := 0; i < MaxFailures; i++ {
+		authenticate("wrong-password")
+	}
+	if _, locked := l.locked("192.0.2.1"); !locked {
+		t.Fatalf("not locked out after %d wrong keys", MaxFailures)
+	}
+
+	cases := []struct {
+		key, user string
+		wait, ok  bool
+	}{
+		// alice's key was verified before the lockout
+		{"password", "alice", false, true},
+		{"sha-password", "", true, false},
+		{"wrong-password", "", true, false},
+	}
+	for _, c := range cases {
+		user, wait, ok := authenticate(c.key)
+		if user != c.user || wait != c.wait || ok != c.ok {
+			t.Errorf("key '%s': got '%s', wait %v, ok %v; want '%s', wait %v, ok %v", c.key, user, wait, ok, c.user, c.wait, c.ok)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package secretbookmark
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// A key in the URL ends up in browser history and server logs. When a browser
+// opens a bookmark over HTTPS, the key is therefore exchanged for a session
+// cookie, and the browser is redirected to the same page without the key.
+// Since browsers send cookies along with requests from other sites too, POST
+// requests in a session need a CSRF token. Clients that pass the key with
+// every request, such as scripts, don't need one.
+
+// SessionTimeout is how long a session lasts
+const SessionTimeout time.Duration = 7 * 24 * time.Hour
+
+const (
+	// CSRFField is the form field containing the CSRF token
+	CSRFField = "csrf_token"
+
+	// CSRFHeader is the HTTP header containing the CSRF token, for requests
+	// that don't have a form body
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// A session is what a session cookie grants access to. It ends when either
+// password file changes.
+type session struct {
+	user             string
+	csrfToken        string
+	expires          time.Time
+	generation       int
+	weakerGeneration int
+}
+
+// csrfKey is the key under which the CSRF token of the session is stored in
+// the request context, for each permission
+type csrfKey Permission
+
+// CSRFToken returns the CSRF token for the session with permission p. It is
+// empty if the request was not authenticated with a session cookie.
+func CSRFToken(ctx context.Context, p Permission) string {
+	token, _ := ctx.Value(csrfKey(p)).(string)
+	return token
+}
+
+// CheckCSRF checks if a request with permission p carries the right CSRF
+// token. Requests that were not authenticated with a session cookie don't
+// need one.
+func CheckCSRF(r *http.Request, p Permission) bool {
+	token := CSRFToken(r.Context(), p)
+	if token == "" {
+		return true
+	}
+
+	given := r.Header.Get(CSRFHeader)
+	if given == "" {
+		given = r.PostFormValue(CSRFField)
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func (s *SecretBookmark) cookieName() string {
+	return s.parameterName + "-session"
+}
+
+// trustedProxies holds the networks of the reverse proxies in front of the
+// server
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets the addresses of the reverse proxies in front of the
+// server, as IP addresses or networks such as 10.0.0.0/8. Only requests from
+// these addresses can claim to be made over HTTPS with the X-Forwarded-Proto
+// header. It should be called before the server starts.
+func TrustProxies(addrs []string) error {
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if ip := net.ParseIP(addr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return fmt.Errorf("invalid proxy address '%s'", addr)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// fromTrustedProxy checks if a request comes from one of the trusted proxies
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHTTPS checks if a request was made over HTTPS, either directly or through
+// a trusted reverse proxy. Anyone can set the X-Forwarded-Proto header, so it
+// is ignored on requests from other addresses.
+func IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return r.Header.Get("X-Forwarded-Proto") == "https" && fromTrustedProxy(r)
+}
+
+// wantsSession checks if the key in a request should be exchanged for a
+// session cookie. This only makes sense for pages opened in a browser, and
+// the cookie can only be kept secure over HTTPS.
+func wantsSession(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return IsHTTPS(r) && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// startSession creates a session for user, and sets the session cookie
+func (s *SecretBookmark) startSession(w http.ResponseWriter, user string) error {
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	gen, weakerGen := s.generations()
+
+	s.mu.Lock()
+	now := time.Now()
+	if s.sessions == nil {
+		s.sessions = make(map[string]session)
+	}
+	for k, v := range s.sessions {
+		if now.After(v.expires) {
+			delete(s.sessions, k)
+		}
+	}
+	s.sessions[id] = session{user, csrfToken, now.Add(SessionTimeout), gen, weakerGen}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(SessionTimeout.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// session looks up the session in the request's session cookie
+func (s *SecretBookmark) session(r *http.Request) (session, bool) {
+	c, err := r.Cookie(s.cookieName())
+	if err != nil || c.Value == "" {
+		return session{}, false
+	}
+	gen, weakerGen := s.generations()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[c.Value]
+	if !ok {
+		return session{}, false
+	}
+	if time.Now().After(sess.expires) || sess.generation != gen || sess.weakerGeneration != weakerGen {
+		delete(s.sessions, c.Value)
+		return session{}, false
+	}
+	return sess, true
+}
+
+// withoutKey returns a relative URL to the requested page, without the key
+func (s *SecretBookmark) withoutKey(r *http.Request) string {
+	q := r.URL.Query()
+	q.Del(s.parameterName)
+
+	rv := "./"
+	if base := path.Base(r.URL.Path); base != "/" && base != "." {
+		rv += base
+	}
+	if len(q) > 0 {
+		rv += "?" + q.Encode()
+	}
+	return rv
+}
@@ -0,0 +1,61 @@
+package secretbookmark
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsHTTPS(t *testing.T) {
+	defer TrustProxies(nil)
+	if err := TrustProxies([]string{"127.0.0.1", " 10.0.0.0/8", "::1", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		proto      string
+		want       bool
+	}{
+		{"direct HTTPS", "192.0.2.1:1234", true, "", true},
+		{"direct HTTP", "192.0.2.1:1234", false, "", false},
+		{"forged header", "192.0.2.1:1234", false, "https", false},
+		{"proxy", "127.0.0.1:1234", false, "https", true},
+		{"proxy network", "10.1.2.3:1234", false, "https", true},
+		{"IPv6 proxy", "[::1]:1234", false, "https", true},
+		{"proxy over HTTP", "127.0.0.1:1234", false, "http", false},
+		{"proxy without header", "127.0.0.1:1234", false, "", false},
+		{"outside the proxy network", "11.1.2.3:1234", false, "https", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/journal", nil)
+		r.RemoteAddr = c.remoteAddr
+		r.TLS = nil
+		if c.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if c.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", c.proto)
+		}
+		r.Header.Set("Accept", "text/html")
+
+		if got := IsHTTPS(r); got != c.want {
+			t.Errorf("%s: IsHTTPS = %v, want %v", c.name, got, c.want)
+		}
+		if got := wantsSession(r); got != c.want {
+			t.Errorf("%s: wantsSession = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTrustProxiesInvalid(t *testing.T) {
+	defer TrustProxies(nil)
+	for _, addr := range []string{"localhost", "10.0.0.0/33", "192.0.2.1:80"} {
+		if err := TrustProxies([]string{addr}); err == nil {
+			t.Errorf("no error for proxy address '%s'", addr)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ThumbnailSize is the maximum width and height of a thumbnail
+const ThumbnailSize int = 480
+
+// MaxThumbnailPixels is the largest image, in pixels, that thumbnails are made
+// of. Decoding an image takes memory in proportion to its size, so this keeps
+// a small file that claims to be huge from exhausting the server's memory.
+const MaxThumbnailPixels int = 50_000_000
+
+// exifHeaderSize is the number of bytes read from the start of a file to find
+// its EXIF data. The APP1 segment can't be larger than 64 KiB.
+const exifHeaderSize int = 70000
+
+var (
+	errNotAnImage    = errors.New("not an image")
+	errImageTooLarge = errors.New("image is too large")
+)
+
+func thumbnailsDir() string {
+	return path.Join(*attachments_dir, ".thumbnails")
+}
+
+func thumbnailPath(att_hash string) string {
+	return path.Join(thumbnailsDir(), att_hash+".jpg")
+}
+
+// readExif reads the EXIF data from the start of a file
+func readExif(filename string) (*exifData, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	buf := make([]byte, exifHeaderSize)
+	n, _ := io.ReadFull(f, buf)
+	return findExif(buf[:n])
+}
+
+// captureTime returns the time a photo was taken, according to its EXIF data
+func captureTime(filename string) (time.Time, bool) {
+	x, ok := readExif(filename)
+	if !ok {
+		return time.Time{}, false
+	}
+	return x.CaptureTime()
+}
+
+// stripGPSFile removes the GPS location from a JPEG photo. It returns true if
+// the file was changed.
+func stripGPSFile(filename string) (bool, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	x, ok := findExif(buf)
+	if !ok || !x.StripGPS() {
+		return false, nil
+	}
+	return true, os.WriteFile(filename, buf, 0600)
+}
+
+// hasGPSFile checks if a file is a JPEG photo with a GPS location
+func hasGPSFile(filename string) (bool, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	x, ok := findExif(buf)
+	return ok && x.HasGPS(), nil
+}
+
+// makeThumbnail creates a thumbnail for a stored attachment. It returns
+// errNotAnImage if the attachment isn't a JPEG, PNG or GIF image, and
+// errImageTooLarge if it has more than MaxThumbnailPixels pixels.
+func makeThumbnail(att_hash string) error {
+	buf, err := os.ReadFile(path.Join(*attachments_dir, att_hash))
+	if err != nil {
+		return err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return errNotAnImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > int64(MaxThumbnailPixels) {
+		return errImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return errNotAnImage
+	}
+
+	orientation := 1
+	if x, ok := findExif(buf); ok {
+		orientation = x.Orientation()
+	}
+	thumb := orient(scaleImage(img, ThumbnailSize), orientation)
+
+	if err := os.MkdirAll(thumbnailsDir(), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(thumbnailsDir(), att_hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(f, thumb, &jpeg.Options{Quality: 80})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), thumbnailPath(att_hash))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// scaleImage scales an image down to fit within size×size pixels, averaging
+// all pixels that end up in the same place
+func scaleImage(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w > h {
+			w, h = size, max1(h*size/w)
+		} else {
+			w, h = max1(w*size/h), size
+		}
+	}
+
+	type sum struct{ r, g, b, a, n uint64 }
+	sums := make([]sum, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		dy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dx := (x - b.Min.X) * w / b.Dx()
+			r, g, bb, a := src.At(x, y).RGBA()
+			s := &sums[dy*w+dx]
+			s.r += uint64(r)
+			s.g += uint64(g)
+			s.b += uint64(bb)
+			s.a += uint64(a)
+			s.n++
+		}
+	}
+
+	rv := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i, s := range sums {
+		if s.n == 0 {
+			continue
+		}
+		rv.SetRGBA(i%w, i/w, color.RGBA{
+			uint8(s.r / s.n >> 8),
+			uint8(s.g / s.n >> 8),
+			uint8(s.b / s.n >> 8),
+			uint8(s.a / s.n >> 8),
+		})
+	}
+	return rv
+}
+
+func max1(i int) int {
+	if i < 1 {
+		return 1
+	}
+	return i
+}
+
+// orient rotates and flips an image according to its EXIF orientation, so it
+// is shown the right way up
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	rv := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			rv.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return rv
+}
+
+// ThumbnailHandler serves the thumbnail of an attached image. Thumbnails are
+// made when an entry is saved, or otherwise the first time they're needed.
+func ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	att_hash := mux.Vars(r)["hash"]
+	if *attachments_dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(thumbnailPath(att_hash))
+	if errors.Is(err, os.ErrNotExist) {
+		if err := makeThumbnail(att_hash); err != nil {
+			if !errors.Is(err, errNotAnImage) && !errors.Is(err, errImageTooLarge) && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Error making thumbnail for '%s': %v", att_hash, err)
+			}
+			http.NotFound(w, r)
+			return
+		}
+		f, err = os.Open(thumbnailPath(att_hash))
+	}
+	if err != nil {
+		errorHandler(err, w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		errorHandler(err, w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "image/jpeg")
+	h.Set("ETag", `"`+att_hash+`-thumbnail"`)
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Uploads are received in chunks, and written to a temporary file in the
+// '.uploads' subdirectory of the attachments directory. The SHA-256 hash of
+// the data is updated with every chunk; once it matches the hash the client
+// claimed, the upload is complete and may be attached to an entry.
+//
+// Every upload belongs to the user who started it, which is recorded in a
+// file next to it. Once it is attached to an entry, that file moves to the
+// '.owners' subdirectory, so stored attachments count towards the quota of
+// the user who uploaded them.
+//
+// Attachments are stored under the hash of the stored file. With --strip_gps,
+// that differs from the hash of the upload if the GPS location was removed;
+// then a file in the '.stripped' subdirectory, named after the upload, points
+// to the stored file. This way, uploading the same photo again doesn't store
+// it twice.
+
+var (
+	errUploadGap      = errors.New("chunk does not continue where the previous one ended")
+	errUploadComplete = errors.New("attachment is already complete")
+	errUploadTooLarge = errors.New("attachment is too large")
+	errQuotaExceeded  = errors.New("upload quota exceeded")
+	errUploadNotYours = errors.New("attachment is being uploaded by another user")
+)
+
+// storedUsage holds the total size of the stored attachments of each user. It
+// is protected by attachmentMutex.
+var storedUsage = make(map[string]int64)
+
+func uploadsDir() string {
+	return path.Join(*attachments_dir, ".uploads")
+}
+
+func uploadPath(att_hash string) string {
+	return path.Join(uploadsDir(), att_hash)
+}
+
+// uploadOwnerPath returns the file containing the owner of a pending upload
+func uploadOwnerPath(att_hash string) string {
+	return uploadPath(att_hash) + ".owner"
+}
+
+func ownersDir() string {
+	return path.Join(*attachments_dir, ".owners")
+}
+
+// ownerPath returns the file containing the owner of a stored attachment
+func ownerPath(att_hash string) string {
+	return path.Join(ownersDir(), att_hash)
+}
+
+func strippedDir() string {
+	return path.Join(*attachments_dir, ".stripped")
+}
+
+// storedHash returns the hash of the stored file for the upload att_hash, if
+// it was stored before. With --strip_gps, a stored photo that still has its
+// GPS location doesn't count.
+func storedHash(att_hash string) (string, bool) {
+	if buf, err := os.ReadFile(path.Join(strippedDir(), att_hash)); err == nil {
+		stored_hash := strings.TrimSpace(string(buf))
+		if _, err := os.Stat(path.Join(*attachments_dir, stored_hash)); validHash(stored_hash) && err == nil {
+			return stored_hash, true
+		}
+	}
+
+	stored := path.Join(*attachments_dir, att_hash)
+	if _, err := os.Stat(stored); err != nil {
+		return "", false
+	}
+	if *strip_gps {
+		if gps, err := hasGPSFile(stored); err != nil || gps {
+			return "", false
+		}
+	}
+	return att_hash, true
+}
+
+// validHash checks if s looks like a SHA-256 hash
+func validHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 64
+}
+
+func readOwner(filename string) (string, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// restoreUploads picks up the uploads that were in progress when the server
+// was last stopped, and adds up the size of each user's stored attachments.
+// The caller should not hold attachmentMutex.
+func restoreUploads() error {
+	if err := os.MkdirAll(uploadsDir(), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ownersDir(), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(strippedDir(), 0700); err != nil {
+		return err
+	}
+
+	attachmentMutex.Lock()
+	defer attachmentMutex.Unlock()
+
+	owners, err := os.ReadDir(ownersDir())
+	if err != nil {
+		return err
+	}
+	for _, fi := range owners {
+		att_hash := fi.Name()
+		if !validHash(att_hash) || fi.IsDir() {
+			continue
+		}
+		user, err := readOwner(ownerPath(att_hash))
+		if err != nil {
+			return err
+		}
+		if st, err := os.Stat(path.Join(*attachments_dir, att_hash)); err == nil {
+			storedUsage[user] += st.Size()
+		}
+	}
+
+	fis, err := os.ReadDir(uploadsDir())
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		att_hash := fi.Name()
+		if !validHash(att_hash) || fi.IsDir() {
+			continue
+		}
+
+		user, err := readOwner(uploadOwnerPath(att_hash))
+		if err != nil {
+			log.Printf("Discarding upload '%s': unknown owner", att_hash)
+			discardUpload(att_hash)
+			continue
+		}
+
+		f, err := os.Open(uploadPath(att_hash))
+		if err != nil {
+			return err
+		}
+		e := attachmentEntry{
+			PurgeAt: time.Now().Add(AttachmentTimeout),
+			User:    user,
+			digest:  sha256.New(),
+		}
+		e.Size, err = io.Copy(e.digest, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		e.Complete = hex.EncodeToString(e.digest.Sum(nil)) == att_hash
+
+		attachments[att_hash] = e
+	}
+
+	return nil
+}
+
+// receiveChunk writes a chunk of an attachment at the given offset. If offset
+// is negative, the chunk is appended to what was received so far. Parts of
+// the chunk that were already received (e.g. when a chunk is retried) are
+// skipped. The caller should hold attachmentMutex.
+func receiveChunk(att_hash, user string, offset int64, chunk []byte) (attachmentEntry, error) {
+	e, ok := attachments[att_hash]
+	if !ok {
+		// There's no need to upload a file that's already stored
+		if stored_hash, ok := storedHash(att_hash); ok {
+			if fi, err := os.Stat(path.Join(*attachments_dir, stored_hash)); err == nil {
+				return attachmentEntry{Size: fi.Size(), Complete: true}, nil
+			}
+		}
+
+		e = attachmentEntry{User: user, digest: sha256.New()}
+	} else if e.User != user {
+		return attachmentEntry{}, errUploadNotYours
+	}
+
+	if offset < 0 {
+		offset = e.Size
+	}
+	if offset > e.Size {
+		return e, errUploadGap
+	}
+	var data []byte
+	if skip := e.Size - offset; skip < int64(len(chunk)) {
+		data = chunk[skip:]
+	}
+	if len(data) > 0 && e.Complete {
+		return e, errUploadComplete
+	}
+	if e.Size+int64(len(data)) > *max_attachment_size {
+		return e, errUploadTooLarge
+	}
+	if userUploads(user)+storedUsage[user]+int64(len(data)) > *upload_quota {
+		return e, errQuotaExceeded
+	}
+	if e.Size == 0 {
+		if err := os.WriteFile(uploadOwnerPath(att_hash), []byte(user+"\n"), 0600); err != nil {
+			return e, err
+		}
+	}
+
+	f, err := os.OpenFile(uploadPath(att_hash), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return e, err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// The file may be partially written; start over
+		discardUpload(att_hash)
+		return attachmentEntry{}, err
+	}
+
+	e.digest.Write(data)
+	e.Size += int64(len(data))
+	e.Complete = hex.EncodeToString(e.digest.Sum(nil)) == att_hash
+	e.PurgeAt = time.Now().Add(AttachmentTimeout)
+	attachments[att_hash] = e
+
+	return e, nil
+}
+
+// userUploads returns the total size of the pending uploads by a user. The
+// caller should hold attachmentMutex.
+func userUploads(user string) int64 {
+	var rv int64
+	for _, e := range attachments {
+		if e.User == user {
+			rv += e.Size
+		}
+	}
+	return rv
+}
+
+// storeUpload moves a complete upload to the attachments directory, and
+// returns the hash it is stored under. Only the user who uploaded it may
+// attach it. If the GPS location is removed from a photo, the photo is stored
+// under the hash of what's left. The stored file counts towards the quota of
+// the user, unless it was already stored. The caller should hold
+// attachmentMutex.
+func storeUpload(att_hash, user string) (string, error) {
+	e, ok := attachments[att_hash]
+	if !ok {
+		return "", fmt.Errorf("attachment %s is not being uploaded", att_hash)
+	}
+	if e.User != user {
+		return "", fmt.Errorf("attachment %s was uploaded by another user", att_hash)
+	}
+	if !e.Complete {
+		return "", fmt.Errorf("attachment %s is incomplete", att_hash)
+	}
+
+	stored_hash := att_hash
+	if *strip_gps {
+		stripped, err := stripGPSFile(uploadPath(att_hash))
+		if err != nil {
+			return "", err
+		}
+		if stripped {
+			if stored_hash, err = fileHash(uploadPath(att_hash)); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(path.Join(strippedDir(), att_hash), []byte(stored_hash+"\n"), 0600); err != nil {
+				log.Printf("Error recording where attachment '%s' is stored: %v", att_hash, err)
+			}
+		}
+	}
+
+	stored := path.Join(*attachments_dir, stored_hash)
+	if _, err := os.Stat(stored); err == nil {
+		// The same file was stored before
+		discardUpload(att_hash)
+		return stored_hash, nil
+	}
+	if err := os.Rename(uploadPath(att_hash), stored); err != nil {
+		return "", err
+	}
+	if err := os.Rename(uploadOwnerPath(att_hash), ownerPath(stored_hash)); err != nil {
+		log.Printf("Error recording the owner of attachment '%s': %v", stored_hash, err)
+	}
+	delete(attachments, att_hash)
+	if fi, err := os.Stat(stored); err == nil {
+		storedUsage[user] += fi.Size()
+	}
+
+	go func() {
+		err := makeThumbnail(stored_hash)
+		if err != nil && !errors.Is(err, errNotAnImage) && !errors.Is(err, errImageTooLarge) {
+			log.Printf("Error making thumbnail for '%s': %v", stored_hash, err)
+		}
+	}()
+	return stored_hash, nil
+}
+
+// fileHash returns the SHA-256 hash of a file
+func fileHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// discardUpload removes a pending upload. The caller should hold
+// attachmentMutex.
+func discardUpload(att_hash string) {
+	delete(attachments, att_hash)
+	for _, filename := range []string{uploadPath(att_hash), uploadOwnerPath(att_hash)} {
+		if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error removing upload '%s': %v", att_hash, err)
+		}
+	}
+}
+
+// copyFile copies the file src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
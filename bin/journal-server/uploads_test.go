@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path"
+	"testing"
+)
+
+func testHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStoreUploadStripGPS(t *testing.T) {
+	// Thumbnails are made in the background, so the attachments directory
+	// isn't reset afterwards
+	*attachments_dir = t.TempDir()
+	defer func(strip bool) { *strip_gps = strip }(*strip_gps)
+	*strip_gps = true
+
+	attachmentMutex.Lock()
+	attachments = make(map[string]attachmentEntry)
+	storedUsage = make(map[string]int64)
+	attachmentMutex.Unlock()
+	if err := restoreUploads(); err != nil {
+		t.Fatal(err)
+	}
+
+	attachmentMutex.Lock()
+	defer attachmentMutex.Unlock()
+
+	// An older copy of a photo, stored before --strip_gps was set
+	oldPhoto := testJPEG(testTIFF(binary.BigEndian))
+	if err := os.WriteFile(path.Join(*attachments_dir, testHash(oldPhoto)), oldPhoto, 0600); err != nil {
+		t.Fatal(err)
+	}
+	notAPhoto := []byte("Not a photo\n")
+
+	cases := []struct {
+		name     string
+		user     string
+		data     []byte
+		stripped bool
+
+		// uploaded is set if the data has to be uploaded; otherwise the
+		// upload is complete right away, as it's stored already
+		uploaded bool
+		usage    int64
+	}{
+		{"photo", "alice", testJPEG(testTIFF(binary.LittleEndian)), true, true, int64(len(oldPhoto))},
+		{"same photo", "bob", testJPEG(testTIFF(binary.LittleEndian)), true, false, 0},
+		{"photo stored with its location", "bob", oldPhoto, true, true, int64(len(oldPhoto))},
+		{"not a photo", "carol", notAPhoto, false, true, int64(len(notAPhoto))},
+		{"same file", "carol", notAPhoto, false, false, int64(len(notAPhoto))},
+	}
+
+	for _, c := range cases {
+		att_hash := testHash(c.data)
+		e, err := receiveChunk(att_hash, c.user, 0, c.data)
+		if err != nil || !e.Complete {
+			t.Errorf("%s: upload complete = %v, error %v", c.name, e.Complete, err)
+			continue
+		}
+
+		stored_hash := att_hash
+		if _, pending := attachments[att_hash]; pending != c.uploaded {
+			t.Errorf("%s: uploaded = %v, want %v", c.name, pending, c.uploaded)
+		} else if pending {
+			if stored_hash, err = storeUpload(att_hash, c.user); err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if owner, err := readOwner(ownerPath(stored_hash)); err != nil || owner != c.user {
+				t.Errorf("%s: stored for '%s', %v; want '%s'", c.name, owner, err, c.user)
+			}
+		} else {
+			stored_hash, _ = storedHash(att_hash)
+		}
+
+		if (stored_hash != att_hash) != c.stripped {
+			t.Errorf("%s: stored under %s, for upload %s", c.name, stored_hash, att_hash)
+		}
+		if h, ok := storedHash(att_hash); !ok || h != stored_hash {
+			t.Errorf("%s: storedHash = %s, %v; want %s", c.name, h, ok, stored_hash)
+		}
+		stored, err := os.ReadFile(path.Join(*attachments_dir, stored_hash))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if testHash(stored) != stored_hash {
+			t.Errorf("%s: the stored file doesn't match its hash", c.name)
+		}
+		if x, ok := findExif(stored); ok && x.HasGPS() {
+			t.Errorf("%s: the stored file has a GPS location", c.name)
+		}
+		if storedUsage[c.user] != c.usage {
+			t.Errorf("%s: usage of '%s' is %d, want %d", c.name, c.user, storedUsage[c.user], c.usage)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+	"golang.org/x/term"
+)
+
+var addOpts struct {
+	Date     string
+	Template string
+	Star     bool
+	Project  string
+	Attach   stringList
+
+	Remote       string
+	Key          string
+	KeyParameter string
+	QueueDir     string
+}
+
+var addCommand = &command{
+	Name:    "add",
+	Args:    "",
+	Summary: "Add a new entry to the journal",
+	Help: `
+Add a new entry to the journal. The contents of the entry are read from stdin.
+
+Unless --date is given, the entry may start with its date followed by a colon,
+such as "yesterday 9pm: ..." or "2023-02-01: ...". A '*' at the end of the
+first line stars the entry.
+
+If stdin is a terminal, the entry is composed in $VISUAL or $EDITOR instead.
+The file starts with the date and time of the new entry; edit this line to
+change the date, or add a '*' after the time to star the entry. Leave the file
+empty to cancel.
+
+Use --project to add the entry to a project in the projects directory as well.
+The entry is appended to the project's log file, and tagged with @project.
+
+Use --attach to attach a file to the entry. The file is copied into the
+attachments directory, and linked from the entry. This can be repeated.
+
+Use --remote and --key to send the entry to journal-server instead, e.g.
+--remote=https://example.com/journal. If the server can't be reached, the
+entry is queued, and sent the next time an entry is added to that server.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&addOpts.Date, "date", "", "Date/time of new entry")
+		fs.BoolVar(&addOpts.Star, "star", false, "Star the new entry")
+		fs.StringVar(&addOpts.Template, "template", "", "Prefill the editor with the contents of this file")
+		fs.StringVar(&addOpts.Project, "project", "", "Also add the entry to this project")
+		fs.Var(&addOpts.Attach, "attach", "Attach this file to the entry (can be repeated)")
+		fs.StringVar(&addOpts.Remote, "remote", "", "Send the entry to the journal-server at this URL")
+		fs.StringVar(&addOpts.Key, "key", "", "API key for the remote server")
+		fs.StringVar(&addOpts.KeyParameter, "key_parameter", "apikey", "Name of the URL parameter containing the API key")
+		fs.StringVar(&addOpts.QueueDir, "queue_dir", defaultQueueDir(), "Directory for entries that could not be sent to the remote server")
+	},
+	Run: runAdd,
+}
+
+func runAdd(fs *flag.FlagSet) error {
+	if fs.NArg() > 0 {
+		return usagef("add", "unexpected argument '%s'", fs.Arg(0))
+	}
+
+	project := addOpts.Project
+	var rem *remote
+	if addOpts.Remote != "" {
+		var err error
+		if rem, err = openRemote(); err != nil {
+			return err
+		}
+	} else if project != "" {
+		var err error
+		if project, err = findProject(addOpts.Project); err != nil {
+			return err
+		}
+	}
+
+	atts, err := readAttachments(addOpts.Attach)
+	if err != nil {
+		return err
+	}
+	if len(atts) > 0 && rem == nil && *attachments_dir == "" {
+		return usagef("add", "--attach requires --attachments_dir")
+	}
+
+	t := journal.SmartTime(addOpts.Date)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		entries, err := composeEntries(t)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Fprintf(os.Stderr, "Empty entry; nothing added.\n")
+			return nil
+		}
+		for i, e := range entries {
+			e.Starred = e.Starred || addOpts.Star
+			if i > 0 {
+				// Only the first entry gets the attachments
+				atts = nil
+			}
+			if err := addEntry(e, project, rem, atts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	c, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	// Remove trailing newlines from the contents
+	for len(c) > 0 && c[len(c)-1] == 0x0a {
+		c = c[0 : len(c)-1]
+	}
+	// Remove carriage returns entirely. Why? Because it fits my use case, and because sod MS-DOS.
+	conts := strings.Replace(string(c), "\r", "", -1)
+	if strings.TrimSpace(conts) == "" {
+		return errors.New("not adding an empty entry")
+	}
+
+	e := &journal.Entry{
+		Date:     t,
+		Starred:  addOpts.Star,
+		Contents: conts}
+
+	if addOpts.Date == "" {
+		if d, rest, ok := journal.InlineDate(e.Contents, time.Now()); ok {
+			e.Date, e.Contents = d, rest
+		}
+	}
+	if rest, starred := journal.InlineStar(e.Contents); starred {
+		e.Contents, e.Starred = rest, true
+	}
+
+	return addEntry(e, project, rem, atts)
+}
+
+// openRemote prepares for sending entries to the remote server, and sends any
+// entries that are still in the queue
+func openRemote() (*remote, error) {
+	if addOpts.Key == "" {
+		return nil, usagef("add", "--remote requires --key")
+	}
+	rem, err := newRemote(addOpts.Remote, addOpts.Key, addOpts.KeyParameter)
+	if err != nil {
+		return nil, usagef("add", "%v", err)
+	}
+
+	n, err := flushQueue(addOpts.QueueDir, rem)
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Sent %d queued entries to the server.\n", n)
+	}
+	if errors.Is(err, errAccessDenied) {
+		return nil, err
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not send queued entries (%v).\n", err)
+	}
+	return rem, nil
+}
+
+// addEntry adds e to the journal, and to the project if one is given. If rem
+// is set, the entry is sent to the remote server instead.
+func addEntry(e *journal.Entry, project string, rem *remote, atts []attachment) error {
+	if rem != nil {
+		// Keep the attachments in the queue until they've been sent
+		attDir := queueAttachmentsDir(addOpts.QueueDir)
+		var hashes []string
+		for _, att := range atts {
+			if err := copyFile(att.Path, filepath.Join(attDir, att.Hash), 0600); err != nil {
+				return err
+			}
+			hashes = append(hashes, att.Hash)
+		}
+		return sendOrQueue(addOpts.QueueDir, rem, e, project, hashes, attDir)
+	}
+
+	projectDir := ""
+	if project != "" {
+		if err := addToProject(project, e); err != nil {
+			return err
+		}
+		projectDir = journal.ProjectDir(*projects_dir, project)
+	}
+	if err := storeAttachments(e, atts, *attachments_dir, projectDir); err != nil {
+		return err
+	}
+	return journal.Add(*journal_file, e)
+}
+
+// composeEntries lets the user write a new entry in their editor. It returns
+// all non-empty entries in the edited file.
+func composeEntries(t time.Time) ([]*journal.Entry, error) {
+	initial := &journal.Entry{Date: t}
+	if addOpts.Template != "" {
+		tpl, err := os.ReadFile(addOpts.Template)
+		if err != nil {
+			return nil, err
+		}
+		initial.Contents = strings.TrimRight(strings.Replace(string(tpl), "\r", "", -1), "\n")
+	}
+
+	var buf bytes.Buffer
+	initial.Serialize(&buf)
+
+	text, err := editText(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	entries, err := deserializeString(text)
+	if errors.Is(err, journal.ErrNoDate) {
+		// The date line was removed; use the default date instead
+		entries, err = []*journal.Entry{{Date: t, Contents: strings.TrimRight(text, "\n")}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*journal.Entry
+	for _, e := range entries {
+		if strings.TrimSpace(e.Contents) == "" {
+			continue
+		}
+		if addOpts.Template != "" && e.Contents == initial.Contents {
+			// The template was left untouched
+			continue
+		}
+		rv = append(rv, e)
+	}
+	return rv, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/thijzert/go-journal"
+)
+
+// Attachments are stored in the attachments directory under their SHA-256
+// hash, and linked from an entry with an '@attachment HASH' line. This is the
+// same layout that journal-server uses.
+
+// An attachment is a file that is to be attached to a new entry
+type attachment struct {
+	// Path is the location of the original file
+	Path string
+
+	// Hash is the hex-encoded SHA-256 hash of the file
+	Hash string
+}
+
+// readAttachments hashes all files to be attached
+func readAttachments(paths []string) ([]attachment, error) {
+	var rv []attachment
+	for _, p := range paths {
+		hash, err := hashFile(p)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, attachment{p, hash})
+	}
+	return rv, nil
+}
+
+// hashFile computes the hex-encoded SHA-256 hash of a file
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeAttachments copies the attachments into dir, and links them in e
+func storeAttachments(e *journal.Entry, atts []attachment, dir string, projectDir string) error {
+	for _, att := range atts {
+		if err := copyFile(att.Path, filepath.Join(dir, att.Hash), 0644); err != nil {
+			return err
+		}
+		if projectDir != "" {
+			if err := copyFile(att.Path, filepath.Join(projectDir, att.Hash), 0644); err != nil {
+				return err
+			}
+		}
+
+		e.Contents = fmt.Sprintf("%s\n@attachment %s", e.Contents, att.Hash)
+	}
+	return nil
+}
+
+// copyFile copies the file src to dst, unless dst already exists. The file is
+// written to a temporary file first, so dst is never incomplete.
+func copyFile(src, dst string, perm os.FileMode) error {
+	if src == dst {
+		return nil
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dirPerm := os.FileMode(0755)
+	if perm&0077 == 0 {
+		dirPerm = 0700
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), dirPerm); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst))
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thijzert/go-journal"
+	"golang.org/x/term"
+)
+
+var browseCommand = &command{
+	Name:    "browse",
+	Args:    "",
+	Summary: "Browse the journal interactively",
+	Help: `
+Browse the journal in a full-screen terminal interface. Entries are listed
+from new to old, with the selected entry shown below the list.
+
+Keys:
+  up/down, j/k    Select the next or previous entry
+  pgup/pgdn       Move a page up or down
+  home/end        Go to the newest or oldest entry
+  space, b        Scroll the selected entry down or up
+  /               Search as you type. Enter keeps the search, esc clears it
+  t               Filter on a tag as you type
+  s               Star or unstar the selected entry
+  e               Edit the selected entry in $VISUAL or $EDITOR
+  o               Open the attachments of the selected entry
+  q               Quit`,
+	Run: runBrowse,
+}
+
+// Browser input modes
+const (
+	modeNormal = iota
+	modeSearch
+	modeTag
+)
+
+// browseFolding is used for matching in the browser. Search-as-you-type is
+// easier if you don't need to care about case or accents.
+var browseFolding = journal.Folding{IgnoreCase: true, IgnoreAccents: true}
+
+type browseEntry struct {
+	*journal.Entry
+
+	// folded contains the folded contents of the entry
+	folded string
+
+	// tags contains the folded tags of the entry
+	tags []string
+}
+
+func newBrowseEntry(e *journal.Entry) *browseEntry {
+	rv := &browseEntry{
+		Entry:  e,
+		folded: browseFolding.Fold(e.Contents),
+	}
+	for _, t := range e.Tags() {
+		rv.tags = append(rv.tags, browseFolding.Fold(t))
+	}
+	return rv
+}
+
+type browser struct {
+	fd       int
+	oldState *term.State
+
+	all     []*browseEntry
+	visible []*browseEntry
+
+	cursor, offset int
+	detailScroll   int
+
+	mode   int
+	search string
+	tag    string
+	status string
+
+	width, height int
+}
+
+func runBrowse(fs *flag.FlagSet) error {
+	if fs.NArg() > 0 {
+		return usagef("browse", "unexpected argument '%s'", fs.Arg(0))
+	}
+
+	b := &browser{fd: int(os.Stdin.Fd())}
+	if !term.IsTerminal(b.fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("browse needs a terminal")
+	}
+
+	if err := b.load(); err != nil {
+		return err
+	}
+
+	if err := b.enterScreen(); err != nil {
+		return err
+	}
+	defer b.leaveScreen()
+
+	keys := make(chan []string)
+	next := make(chan bool)
+	go readKeys(keys, next)
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	next <- true
+	b.draw()
+	for {
+		select {
+		case ks := <-keys:
+			for _, k := range ks {
+				quit, err := b.handleKey(k)
+				if err != nil {
+					b.status = "Error: " + humanError(err)
+				}
+				if quit {
+					return nil
+				}
+			}
+			next <- true
+			b.draw()
+		case <-ticker.C:
+			if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w >= 20 && h >= 10 && (w != b.width || h != b.height) {
+				b.draw()
+			}
+		}
+	}
+}
+
+// load reads all entries from the journal
+func (b *browser) load() error {
+	result, err := journal.Find(*journal_file, journal.Query{})
+	if err != nil {
+		return err
+	}
+
+	b.all = b.all[:0]
+	for e := range result {
+		b.all = append(b.all, newBrowseEntry(e))
+	}
+
+	// Show the newest entries first
+	for i, j := 0, len(b.all)-1; i < j; i, j = i+1, j-1 {
+		b.all[i], b.all[j] = b.all[j], b.all[i]
+	}
+
+	b.filter()
+	return nil
+}
+
+// filter applies the search query and the tag filter
+func (b *browser) filter() {
+	var selected *journal.Entry
+	if b.cursor < len(b.visible) {
+		selected = b.visible[b.cursor].Entry
+	}
+
+	terms := strings.Fields(browseFolding.Fold(b.search))
+	tag := browseFolding.Fold(b.tag)
+	if tag != "" && !strings.HasPrefix(tag, "@") {
+		tag = "@" + tag
+	}
+
+	b.visible = b.visible[:0]
+	for _, e := range b.all {
+		if e.matches(terms, tag) {
+			b.visible = append(b.visible, e)
+		}
+	}
+
+	b.cursor, b.offset, b.detailScroll = 0, 0, 0
+	for i, e := range b.visible {
+		if e.Entry == selected {
+			b.cursor = i
+		}
+	}
+}
+
+func (e *browseEntry) matches(terms []string, tag string) bool {
+	for _, t := range terms {
+		if !strings.Contains(e.folded, t) {
+			return false
+		}
+	}
+	if tag == "" {
+		return true
+	}
+	for _, t := range e.tags {
+		if strings.HasPrefix(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *browser) selected() *browseEntry {
+	if b.cursor < 0 || b.cursor >= len(b.visible) {
+		return nil
+	}
+	return b.visible[b.cursor]
+}
+
+func (b *browser) move(delta int) {
+	b.cursor += delta
+	if b.cursor >= len(b.visible) {
+		b.cursor = len(b.visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.detailScroll = 0
+}
+
+// listHeight is the number of rows available for the list of entries
+func (b *browser) listHeight() int {
+	h := (b.height - 3) * 2 / 5
+	if h < 3 {
+		h = 3
+	}
+	return h
+}
+
+func (b *browser) detailHeight() int {
+	h := b.height - 3 - b.listHeight()
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// handleKey processes a key press. It returns true if the browser should quit.
+func (b *browser) handleKey(k string) (bool, error) {
+	b.status = ""
+
+	if b.mode != modeNormal {
+		target := &b.search
+		if b.mode == modeTag {
+			target = &b.tag
+		}
+
+		switch k {
+		case "esc":
+			*target = ""
+			b.mode = modeNormal
+		case "enter":
+			b.mode = modeNormal
+		case "backspace":
+			if *target != "" {
+				_, size := utf8.DecodeLastRuneInString(*target)
+				*target = (*target)[:len(*target)-size]
+			}
+		case "ctrl-c":
+			return true, nil
+		default:
+			if utf8.RuneCountInString(k) != 1 {
+				return false, nil
+			}
+			*target += k
+		}
+		b.filter()
+		return false, nil
+	}
+
+	switch k {
+	case "q", "ctrl-c":
+		return true, nil
+	case "down", "j":
+		b.move(1)
+	case "up", "k":
+		b.move(-1)
+	case "pgdn":
+		b.move(b.listHeight())
+	case "pgup":
+		b.move(-b.listHeight())
+	case "home", "g":
+		b.move(-len(b.visible))
+	case "end", "G":
+		b.move(len(b.visible))
+	case " ":
+		b.detailScroll += b.detailHeight() - 1
+	case "b":
+		b.detailScroll -= b.detailHeight() - 1
+		if b.detailScroll < 0 {
+			b.detailScroll = 0
+		}
+	case "/":
+		b.mode = modeSearch
+	case "t":
+		b.mode = modeTag
+	case "esc":
+		b.search, b.tag = "", ""
+		b.filter()
+	case "s", "*":
+		return false, b.toggleStar()
+	case "e":
+		return false, b.edit()
+	case "o":
+		return false, b.openAttachments()
+	}
+
+	return false, nil
+}
+
+// toggleStar stars or unstars the selected entry
+func (b *browser) toggleStar() error {
+	sel := b.selected()
+	if sel == nil {
+		return nil
+	}
+
+	target := *sel.Entry
+	done := false
+	err := journal.Rewrite(*journal_file, func(e *journal.Entry) []*journal.Entry {
+		if !done && sameEntry(e, &target) {
+			done = true
+			e.Starred = !e.Starred
+		}
+		return []*journal.Entry{e}
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return errors.New("the entry was changed by someone else; restart to reload the journal")
+	}
+
+	sel.Starred = !sel.Starred
+	if sel.Starred {
+		b.status = "Starred"
+	} else {
+		b.status = "Unstarred"
+	}
+	return nil
+}
+
+// edit opens the selected entry in the user's editor
+func (b *browser) edit() error {
+	sel := b.selected()
+	if sel == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	sel.Serialize(&buf)
+
+	b.leaveScreen()
+	edited, err := editText(buf.String())
+	if serr := b.enterScreen(); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return err
+	}
+	if edited == buf.String() {
+		b.status = "No changes made"
+		return nil
+	}
+	if strings.TrimSpace(edited) == "" {
+		b.status = "Empty file; edit cancelled"
+		return nil
+	}
+
+	replacements, err := deserializeString(edited)
+	if err != nil {
+		return err
+	}
+
+	target := *sel.Entry
+	done := false
+	err = journal.Rewrite(*journal_file, func(e *journal.Entry) []*journal.Entry {
+		if !done && sameEntry(e, &target) {
+			done = true
+			return replacements
+		}
+		return []*journal.Entry{e}
+	})
+	if err != nil {
+		return err
+	}
+
+	b.status = "Entry saved"
+	if err := b.load(); err != nil {
+		return err
+	}
+	for i, e := range b.visible {
+		if len(replacements) > 0 && sameEntry(e.Entry, replacements[0]) {
+			b.cursor = i
+		}
+	}
+	return nil
+}
+
+// openAttachments opens all files attached to the selected entry
+func (b *browser) openAttachments() error {
+	sel := b.selected()
+	if sel == nil {
+		return nil
+	}
+
+	hashes := sel.Attachments()
+	if len(hashes) == 0 {
+		b.status = "This entry has no attachments"
+		return nil
+	}
+	if *attachments_dir == "" {
+		b.status = "Use --attachments_dir to open attachments"
+		return nil
+	}
+
+	for _, hash := range hashes {
+		if err := openFile(filepath.Join(*attachments_dir, hash)); err != nil {
+			return err
+		}
+	}
+	b.status = fmt.Sprintf("Opened %d attachment(s)", len(hashes))
+	return nil
+}
+
+// openFile opens a file in its default application
+func openFile(name string) error {
+	if _, err := os.Stat(name); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", name)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", name)
+	default:
+		cmd = exec.Command("xdg-open", name)
+	}
+	return cmd.Start()
+}
+
+// enterScreen switches the terminal to raw mode, and to the alternate screen
+func (b *browser) enterScreen() error {
+	state, err := term.MakeRaw(b.fd)
+	if err != nil {
+		return err
+	}
+	b.oldState = state
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return nil
+}
+
+// leaveScreen restores the terminal
+func (b *browser) leaveScreen() {
+	if b.oldState == nil {
+		return
+	}
+	os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	term.Restore(b.fd, b.oldState)
+	b.oldState = nil
+}
+
+// draw renders the entire screen
+func (b *browser) draw() {
+	b.width, b.height = 80, 24
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w >= 20 && h >= 10 {
+		b.width, b.height = w, h
+	}
+
+	var buf bytes.Buffer
+	row := 1
+	line := func(s string) {
+		fmt.Fprintf(&buf, "\x1b[%d;1H%s\x1b[0m\x1b[K", row, s)
+		row++
+	}
+
+	// Header
+	header := fmt.Sprintf(" %d of %d entries", len(b.visible), len(b.all))
+	if b.search != "" {
+		header += fmt.Sprintf("  search: %s", b.search)
+	}
+	if b.tag != "" {
+		header += fmt.Sprintf("  tag: %s", b.tag)
+	}
+	line(ansiBold + truncate(header, b.width))
+
+	// List of entries
+	lh := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if b.cursor >= b.offset+lh {
+		b.offset = b.cursor - lh + 1
+	}
+	for i := b.offset; i < b.offset+lh; i++ {
+		if i >= len(b.visible) {
+			line("")
+			continue
+		}
+		e := b.visible[i]
+		star := " "
+		if e.Starred {
+			star = "★"
+		}
+		s := truncate(fmt.Sprintf(" %s %s %s", e.Date.Format("2006-01-02 15:04"), star, e.Title()), b.width)
+		if i == b.cursor {
+			if pad := b.width - utf8.RuneCountInString(s); pad > 0 {
+				s += strings.Repeat(" ", pad)
+			}
+			s = "\x1b[7m" + s
+		}
+		line(s)
+	}
+
+	line(strings.Repeat("─", b.width))
+
+	// Selected entry
+	dh := b.detailHeight()
+	var detail []string
+	if sel := b.selected(); sel != nil {
+		var db bytes.Buffer
+		p := prettyPrinter{
+			Width:  b.width,
+			Colour: true,
+			Query:  journal.Query{Terms: strings.Fields(b.search), Folding: browseFolding},
+		}
+		p.Print(&db, sel.Entry)
+		detail = strings.Split(strings.TrimRight(db.String(), "\n"), "\n")
+	}
+	if b.detailScroll > len(detail)-1 {
+		b.detailScroll = len(detail) - 1
+	}
+	if b.detailScroll < 0 {
+		b.detailScroll = 0
+	}
+	for i := b.detailScroll; i < b.detailScroll+dh; i++ {
+		if i < len(detail) {
+			line(detail[i])
+		} else {
+			line("")
+		}
+	}
+
+	// Status line
+	switch {
+	case b.mode == modeSearch:
+		line("Search: " + b.search + "\x1b[7m \x1b[0m")
+	case b.mode == modeTag:
+		line("Tag: @" + strings.TrimPrefix(b.tag, "@") + "\x1b[7m \x1b[0m")
+	case b.status != "":
+		line(truncate(b.status, b.width))
+	default:
+		line(truncate("/ search  t tag  s star  e edit  o open  q quit", b.width))
+	}
+
+	os.Stdout.Write(buf.Bytes())
+}
+
+// truncate shortens s to at most width characters
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == width-1 {
+			return s[:i] + "…"
+		}
+		n++
+	}
+	return s
+}
+
+// readKeys reads key presses from stdin, and sends them to keys. It only
+// reads after receiving a value on next, so it won't steal input from
+// programs started by the browser.
+func readKeys(keys chan<- []string, next <-chan bool) {
+	buf := make([]byte, 256)
+	for range next {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			keys <- []string{"ctrl-c"}
+			return
+		}
+		keys <- parseKeys(buf[:n])
+	}
+}
+
+var escapeSequences = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1b[C":  "right",
+	"\x1b[D":  "left",
+	"\x1bOA":  "up",
+	"\x1bOB":  "down",
+	"\x1b[H":  "home",
+	"\x1b[F":  "end",
+	"\x1b[1~": "home",
+	"\x1b[4~": "end",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdn",
+}
+
+// parseKeys translates raw input into key names
+func parseKeys(b []byte) []string {
+	var rv []string
+	for len(b) > 0 {
+		k, n := parseKey(b)
+		rv = append(rv, k)
+		b = b[n:]
+	}
+	return rv
+}
+
+// parseKey translates the first key in b. It returns its name, and the number of bytes used.
+func parseKey(b []byte) (string, int) {
+	switch b[0] {
+	case 0x1b:
+		if len(b) == 1 {
+			return "esc", 1
+		}
+		for seq, name := range escapeSequences {
+			if bytes.HasPrefix(b, []byte(seq)) {
+				return name, len(seq)
+			}
+		}
+		// Ignore unknown escape sequences entirely
+		return "unknown", len(b)
+	case 0x03, 0x04:
+		return "ctrl-c", 1
+	case '\r', '\n':
+		return "enter", 1
+	case 0x7f, 0x08:
+		return "backspace", 1
+	case '\t':
+		return "tab", 1
+	}
+
+	r, size := utf8.DecodeRune(b)
+	return string(r), size
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+	"golang.org/x/term"
+)
+
+var calendarOpts struct {
+	Words bool
+}
+
+var calendarCommand = &command{
+	Name:    "calendar",
+	Args:    "[YEAR] [TERM...]",
+	Summary: "Show a calendar of when entries were written",
+	Help: `
+Draw a calendar of a year (default: this year), with a square for every day
+that is darker the more entries were written on that day. Starred days are
+marked with a star. Use --words to count the number of words instead.
+
+If search terms are given, only entries containing all terms are counted. The
+same filters as in 'jrnl search' can be used as well.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		setFilterFlags(fs)
+		fs.BoolVar(&calendarOpts.Words, "words", false, "Count words instead of entries")
+	},
+	Run: runCalendar,
+}
+
+// Calendar colours, from no entries to many entries
+var calendarColours = []string{"\x1b[38;5;238m", "\x1b[38;5;22m", "\x1b[38;5;28m", "\x1b[38;5;34m", "\x1b[38;5;40m"}
+
+// Calendar squares without colours, from no entries to many entries
+var calendarShades = []string{"·", "░", "▒", "▓", "█"}
+
+func runCalendar(fs *flag.FlagSet) error {
+	args := fs.Args()
+	year := time.Now().Year()
+	if len(args) > 0 && len(args[0]) == 4 {
+		if y, err := strconv.Atoi(args[0]); err == nil {
+			year = y
+			args = args[1:]
+		}
+	}
+
+	q, err := buildQuery("calendar", args)
+	if err != nil {
+		return err
+	}
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+	if q.From.Before(start) {
+		q.From = start
+	}
+	if q.To.IsZero() || q.To.After(end) {
+		q.To = end
+	}
+
+	result, err := journal.Find(*journal_file, q)
+	if err != nil {
+		return err
+	}
+	if filterOpts.Last > 0 {
+		result = lastEntries(result, filterOpts.Last)
+	}
+
+	cal := calendar{
+		Year:  year,
+		Days:  journal.Days(result),
+		Words: calendarOpts.Words,
+		Width: 80,
+	}
+	if fd := int(os.Stdout.Fd()); term.IsTerminal(fd) {
+		cal.Colour = colourEnabled()
+		if w, _, err := term.GetSize(fd); err == nil && w > 20 {
+			cal.Width = w
+		}
+	}
+
+	if err := cal.Print(os.Stdout); err != nil {
+		return err
+	}
+	if len(cal.Days) == 0 {
+		return errNoEntries
+	}
+	return nil
+}
+
+// A calendar draws a heatmap of a year
+type calendar struct {
+	Year  int
+	Days  map[string]*journal.Day
+	Words bool
+
+	Width  int
+	Colour bool
+}
+
+// value returns the number of entries or words on a day
+func (c calendar) value(d *journal.Day) int {
+	if d == nil {
+		return 0
+	} else if c.Words {
+		return d.Words
+	}
+	return d.Entries
+}
+
+// Print draws the calendar. If it doesn't fit the width, it is split up into
+// several blocks of weeks.
+func (c calendar) Print(w io.Writer) error {
+	// Weeks start on monday. The first column holds the week of January 1st.
+	jan1 := time.Date(c.Year, 1, 1, 0, 0, 0, 0, time.Local)
+	first := jan1.AddDate(0, 0, -((int(jan1.Weekday()) + 6) % 7))
+	weeks := (int(time.Date(c.Year, 12, 31, 12, 0, 0, 0, time.Local).Sub(first).Hours()/24) / 7) + 1
+
+	max := 0
+	total := 0
+	for _, d := range c.Days {
+		if v := c.value(d); v > max {
+			max = v
+		}
+		total += c.value(d)
+	}
+
+	perBlock := (c.Width - 4) / 2
+	if perBlock < 5 {
+		perBlock = 5
+	}
+	blocks := (weeks + perBlock - 1) / perBlock
+	perBlock = (weeks + blocks - 1) / blocks
+
+	var b strings.Builder
+	for from := 0; from < weeks; from += perBlock {
+		to := from + perBlock
+		if to > weeks {
+			to = weeks
+		}
+		if from > 0 {
+			b.WriteString("\n")
+		}
+		c.printBlock(&b, first, from, to, max)
+	}
+
+	b.WriteString("\n")
+	b.WriteString("    Less ")
+	for level := range calendarShades {
+		b.WriteString(c.square(level, false) + " ")
+	}
+	b.WriteString("More   ")
+	b.WriteString(c.square(len(calendarShades)-1, true) + " Starred\n")
+
+	unit := "entries"
+	if c.Words {
+		unit = "words"
+	}
+	fmt.Fprintf(&b, "    %d %s on %d days in %d\n", total, unit, len(c.Days), c.Year)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printBlock draws weeks from up to to, starting at the monday first
+func (c calendar) printBlock(b *strings.Builder, first time.Time, from, to int, max int) {
+	// Month names, above the week in which the month starts
+	header := []rune(strings.Repeat(" ", 4+2*(to-from)+3))
+	for week := from; week < to; week++ {
+		for i := 0; i < 7; i++ {
+			day := first.AddDate(0, 0, 7*week+i)
+			if day.Day() == 1 && day.Year() == c.Year {
+				copy(header[4+2*(week-from):], []rune(day.Format("Jan")))
+			}
+		}
+	}
+	b.WriteString(strings.TrimRight(string(header), " ") + "\n")
+
+	today := time.Now()
+	labels := []string{"Mon", "", "Wed", "", "Fri", "", "Sun"}
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(b, "%-3s ", labels[i])
+		line := ""
+		for week := from; week < to; week++ {
+			day := first.AddDate(0, 0, 7*week+i)
+			if day.Year() != c.Year || day.After(today) {
+				line += "  "
+				continue
+			}
+			d := c.Days[day.Format("2006-01-02")]
+			line += c.square(level(c.value(d), max), d != nil && d.Starred) + " "
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+}
+
+// level determines how dark the square for value should be
+func level(value, max int) int {
+	if value <= 0 || max <= 0 {
+		return 0
+	}
+	// Spread the values from 1 to max evenly over the levels
+	n := len(calendarShades) - 1
+	if max == 1 {
+		return n
+	}
+	return 1 + ((value-1)*(n-1)+(max-1)/2)/(max-1)
+}
+
+// square returns a single calendar square
+func (c calendar) square(level int, starred bool) string {
+	if !c.Colour {
+		if starred {
+			return "*"
+		}
+		return calendarShades[level]
+	}
+
+	s := "■"
+	if starred {
+		s = "★"
+	}
+	return calendarColours[level] + s + ansiReset
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/thijzert/go-journal"
+)
+
+var completionCommand = &command{
+	Name:    "completion",
+	Args:    "bash|zsh|fish",
+	Summary: "Print a shell completion script",
+	Help: `
+Print a script that sets up tab completion for jrnl in the given shell.
+Besides commands and flags, this completes existing @tags, the names of
+projects in the projects directory, and the names of journals in the journals
+directory.
+
+To enable completion, add one of these lines to your shell's startup file:
+
+  bash:  source <(jrnl completion bash)
+  zsh:   source <(jrnl completion zsh)
+  fish:  jrnl completion fish | source`,
+	Run: runCompletion,
+}
+
+// completeCommand does the actual completing for the completion scripts. It
+// receives the command line up to and including the word being completed, and
+// prints all possible completions of that word, one per line.
+var completeCommand = &command{
+	Name:    "__complete",
+	Args:    "WORD...",
+	Summary: "Complete a command line",
+	Hidden:  true,
+	Run:     runComplete,
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for jrnl
+_jrnl() {
+	local IFS=$'\n'
+	COMPREPLY=($(jrnl __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+
+	# Bash splits --flag=value into three words, but only completes the value
+	if [[ ${COMP_WORDS[COMP_CWORD]} == "=" || ${COMP_WORDS[COMP_CWORD-1]} == "=" ]]; then
+		COMPREPLY=("${COMPREPLY[@]#*=}")
+	fi
+}
+complete -o default -F _jrnl jrnl
+`,
+	"zsh": `#compdef jrnl
+# zsh completion for jrnl
+_jrnl() {
+	local -a candidates
+	candidates=("${(@f)$(jrnl __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	candidates=(${candidates:#})
+	if (( ${#candidates} )); then
+		compadd -Q -- "${candidates[@]}"
+	else
+		_files
+	fi
+}
+compdef _jrnl jrnl
+`,
+	"fish": `# fish completion for jrnl
+function __jrnl_complete
+	set -l words (commandline -opc) (commandline -ct)
+	set -l candidates (jrnl __complete -- $words[2..-1] 2>/dev/null)
+	if test (count $candidates) -gt 0
+		printf '%s\n' $candidates
+	else
+		__fish_complete_path (commandline -ct)
+	end
+end
+complete -c jrnl -f -a '(__jrnl_complete)'
+`,
+}
+
+func runCompletion(fs *flag.FlagSet) error {
+	if fs.NArg() != 1 {
+		return usagef("completion", "expected one of bash, zsh or fish")
+	}
+
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		return usagef("completion", "unsupported shell '%s'", fs.Arg(0))
+	}
+	_, err := io.WriteString(os.Stdout, script)
+	return err
+}
+
+func runComplete(fs *flag.FlagSet) error {
+	words := joinAssignments(fs.Args())
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	for _, c := range complete(words) {
+		fmt.Fprintln(os.Stdout, c)
+	}
+	return nil
+}
+
+// joinAssignments undoes bash's habit of splitting "--flag=value" into
+// "--flag", "=" and "value"
+func joinAssignments(words []string) []string {
+	var rv []string
+	for i := 0; i < len(words); i++ {
+		if words[i] == "=" && len(rv) > 0 && strings.HasPrefix(rv[len(rv)-1], "-") {
+			rv[len(rv)-1] += "="
+			if i+1 < len(words) {
+				rv[len(rv)-1] += words[i+1]
+				i++
+			}
+			continue
+		}
+		rv = append(rv, words[i])
+	}
+	return rv
+}
+
+// complete returns all completions of the last word in words
+func complete(words []string) []string {
+	cur := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	// Find the command, and apply any global flags so the right journal is used
+	global := flag.NewFlagSet("jrnl", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	setGlobalFlags(global)
+	global.Parse(words)
+	if *journal_name != "" {
+		*journal_file = namedJournal(*journal_name)
+	}
+
+	if global.NArg() == 0 {
+		if strings.HasPrefix(cur, "-") {
+			return completeFlag(global, cur)
+		}
+		if flagValue(global, words) != nil {
+			return completeFlagValue(words[len(words)-1], cur)
+		}
+
+		return matching(append(commandNames(), "help"), cur)
+	}
+
+	args := global.Args()
+	if args[0] == "help" {
+		if len(args) == 1 {
+			return matching(commandNames(), cur)
+		}
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return nil
+	}
+	args = args[1:]
+
+	// Parse the command's flags too, as global flags may also follow the command
+	fs := newFlagSet(cmd)
+	fs.Parse(args)
+	if *journal_name != "" {
+		*journal_file = namedJournal(*journal_name)
+	}
+
+	if strings.HasPrefix(cur, "-") && !seenTerminator(args) {
+		return completeFlag(fs, cur)
+	}
+	if !seenTerminator(args) && flagValue(fs, args) != nil {
+		return completeFlagValue(args[len(args)-1], cur)
+	}
+
+	switch {
+	case cmd == completionCommand:
+		if len(args) == 0 {
+			return matching([]string{"bash", "fish", "zsh"}, cur)
+		}
+	case cmd == tagsCommand && len(args) == 0:
+		return matching([]string{"merge", "rename"}, cur)
+	case strings.HasPrefix(cur, "@"):
+		return matching(journalTags(), cur)
+	}
+	return nil
+}
+
+// commandNames lists the names of all visible commands
+func commandNames() []string {
+	var rv []string
+	for _, c := range commands {
+		if !c.Hidden {
+			rv = append(rv, c.Name)
+		}
+	}
+	return rv
+}
+
+// seenTerminator checks if args contains "--", after which there are no flags
+func seenTerminator(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return true
+		}
+	}
+	return false
+}
+
+// flagValue checks if the last word in args is a flag that expects a value in
+// the next word. If so, it returns that flag.
+func flagValue(fs *flag.FlagSet, args []string) *flag.Flag {
+	if len(args) == 0 {
+		return nil
+	}
+	last := args[len(args)-1]
+	if !strings.HasPrefix(last, "-") || strings.Contains(last, "=") {
+		return nil
+	}
+
+	f := fs.Lookup(strings.TrimLeft(last, "-"))
+	if f == nil {
+		return nil
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return nil
+	}
+	return f
+}
+
+// completeFlag completes a flag name, or the value in "--flag=value"
+func completeFlag(fs *flag.FlagSet, cur string) []string {
+	if name, value, ok := strings.Cut(cur, "="); ok {
+		var rv []string
+		for _, v := range completeFlagValue(name, value) {
+			rv = append(rv, name+"="+v)
+		}
+		return rv
+	}
+
+	// Keep the number of dashes the user started with
+	dashes := "-"
+	if strings.HasPrefix(cur, "--") {
+		dashes = "--"
+	}
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, dashes+f.Name)
+	})
+	return matching(names, cur)
+}
+
+// completeFlagValue completes the value of a flag. It returns nil for flags
+// whose values can't be completed, such as file names; the completion scripts
+// complete those as file names instead.
+func completeFlagValue(flagName, cur string) []string {
+	switch strings.TrimLeft(flagName, "-") {
+	case "format":
+		return matching(formatNames(), cur)
+	case "tag":
+		if cur == "" {
+			cur = "@"
+		}
+		return matching(journalTags(), cur)
+	case "project":
+		projects, _ := listProjects()
+		var rv []string
+		for _, p := range projects {
+			rv = append(rv, journal.StripProjectSuffix(p))
+		}
+		return matching(rv, cur)
+	case "journal":
+		journals, _ := listJournals()
+		return matching(journals, cur)
+	case "date", "from", "to", "on":
+		return matching([]string{"today", "yesterday"}, cur)
+	}
+	return nil
+}
+
+// journalTags lists all tags in the journal
+func journalTags() []string {
+	all, err := journal.Find(*journal_file, journal.Query{})
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for e := range all {
+		for _, tag := range e.Tags() {
+			seen[tag] = true
+		}
+	}
+
+	var rv []string
+	for tag := range seen {
+		rv = append(rv, tag)
+	}
+	return rv
+}
+
+// matching returns the sorted candidates that start with prefix
+func matching(candidates []string, prefix string) []string {
+	var rv []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			rv = append(rv, c)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseDay parses a date in the form YYYY-MM-DD, or one of the words 'today' and 'yesterday'
+func parseDay(s string) (time.Time, error) {
+	now := time.Now()
+	switch strings.ToLower(s) {
+	case "today":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid date '%s': use the format YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// parseTime parses a date in the form YYYY-MM-DD, or a date and time in the
+// form YYYY-MM-DD HH:MM. dayOnly is set if no time was specified.
+func parseTime(s string) (t time.Time, dayOnly bool, err error) {
+	t, err = time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err == nil {
+		return t, false, nil
+	}
+
+	t, err = parseDay(s)
+	if err != nil {
+		return t, false, fmt.Errorf("invalid date '%s': use the format YYYY-MM-DD or YYYY-MM-DD HH:MM", s)
+	}
+	return t, true, nil
+}
+
+// dayRange returns the start of the day t is in, and the start of the next day
+func dayRange(t time.Time) (start, end time.Time) {
+	y, m, d := t.Date()
+	start = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	end = start.AddDate(0, 0, 1)
+	return
+}
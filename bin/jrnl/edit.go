@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thijzert/go-journal"
+)
+
+var editCommand = &command{
+	Name:    "edit",
+	Args:    "[DATE]",
+	Summary: "Edit existing entries in your editor",
+	Help: `
+Open existing entries in $VISUAL or $EDITOR. Without arguments, the most recent
+entry is edited. If DATE (YYYY-MM-DD) is given, all entries of that day are
+edited. The journal is updated after the editor exits. Saving an empty file
+cancels the edit.`,
+	Run: runEdit,
+}
+
+func runEdit(fs *flag.FlagSet) error {
+	if fs.NArg() > 1 {
+		return usagef("edit", "too many arguments")
+	}
+
+	q := journal.Query{}
+	if fs.NArg() == 1 {
+		day, err := parseDay(fs.Arg(0))
+		if err != nil {
+			return usagef("edit", "%v", err)
+		}
+		q.From, q.To = dayRange(day)
+	}
+
+	result, err := journal.Find(*journal_file, q)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		result = lastEntries(result, 1)
+	}
+
+	var targets []*journal.Entry
+	for e := range result {
+		targets = append(targets, e)
+	}
+	if len(targets) == 0 {
+		return errNoEntries
+	}
+
+	var buf bytes.Buffer
+	for i, e := range targets {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		e.Serialize(&buf)
+	}
+
+	edited, err := editText(buf.String())
+	if err != nil {
+		return err
+	}
+	if edited == buf.String() {
+		fmt.Fprintf(os.Stderr, "No changes made.\n")
+		return nil
+	}
+	if strings.TrimSpace(edited) == "" {
+		fmt.Fprintf(os.Stderr, "Empty file; edit cancelled.\n")
+		return nil
+	}
+
+	replacements, err := deserializeString(edited)
+	if err != nil {
+		return err
+	}
+
+	// Replace the first target with the edited entries, and remove all others
+	remaining := make([]*journal.Entry, len(targets))
+	copy(remaining, targets)
+	return journal.Rewrite(*journal_file, func(e *journal.Entry) []*journal.Entry {
+		for i, t := range remaining {
+			if t == nil || !sameEntry(e, t) {
+				continue
+			}
+			remaining[i] = nil
+			if i == 0 {
+				return replacements
+			}
+			return nil
+		}
+		return []*journal.Entry{e}
+	})
+}
+
+func sameEntry(a, b *journal.Entry) bool {
+	return a.Date.Equal(b.Date) && a.Starred == b.Starred && a.Contents == b.Contents
+}
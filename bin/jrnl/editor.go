@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/thijzert/go-journal"
+)
+
+// deserializeString parses all entries in s
+func deserializeString(s string) ([]*journal.Entry, error) {
+	c := make(chan *journal.Entry, 5)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- journal.Deserialize(strings.NewReader(s), c)
+	}()
+
+	var rv []*journal.Entry
+	for e := range c {
+		rv = append(rv, e)
+	}
+	if err := <-errc; err != nil {
+		if errors.Is(err, journal.ErrNoDate) {
+			return nil, fmt.Errorf("every entry should start with a date and time (YYYY-MM-DD HH:MM): %w", err)
+		}
+		return nil, err
+	}
+	return rv, nil
+}
+
+// editorCommand returns the user's preferred editor
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if ed := strings.Fields(os.Getenv(env)); len(ed) > 0 {
+			return ed
+		}
+	}
+	return []string{"vi"}
+}
+
+// editText opens text in the user's editor, and returns the edited text
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "jrnl-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	ed := editorCommand()
+	cmd := exec.Command(ed[0], append(ed[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running editor '%s': %w", ed[0], err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	// Remove carriage returns entirely. Why? Because it fits my use case, and because sod MS-DOS.
+	return strings.Replace(string(b), "\r", "", -1), nil
+}
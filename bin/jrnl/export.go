@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+var exportOpts struct {
+	Output string
+	HTML   string
+}
+
+var exportCommand = &command{
+	Name:    "export",
+	Args:    "[TERM...]",
+	Summary: "Export journal entries",
+	Help: `
+Export all entries containing every search term (or all entries, if no terms
+are given) to stdout or a file. By default, entries are exported in the journal
+format; use --format to select another format. The same filters as in
+'jrnl search' can be used to select entries.
+
+Use --html to export the entries as a static website instead, with a page for
+every day and every tag, and a search function. Attachments are included if
+--attachments_dir is set. The site works without a web server, so it can be
+read offline by opening index.html in a browser.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&exportOpts.Output, "o", "", "Write to this file instead of stdout")
+		fs.StringVar(&exportOpts.HTML, "html", "", "Export a static website to this directory")
+		setFilterFlags(fs)
+		fs.StringVar(&outputOpts.Format, "format", "journal", "Output format: one of "+strings.Join(formatNames(), ", "))
+	},
+	Run: runExport,
+}
+
+func runExport(fs *flag.FlagSet) error {
+	if exportOpts.HTML != "" {
+		if exportOpts.Output != "" {
+			return usagef("export", "-o can't be combined with --html")
+		}
+		result, _, err := findEntries("export", fs.Args())
+		if err != nil {
+			return err
+		}
+		return exportHTML(exportOpts.HTML, result)
+	}
+
+	format, ok := formatters[outputOpts.Format]
+	if !ok {
+		return usagef("export", "unknown output format '%s'", outputOpts.Format)
+	}
+
+	result, q, err := findEntries("export", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if exportOpts.Output != "" {
+		out, err = os.Create(exportOpts.Output)
+		if err != nil {
+			drain(result)
+			return err
+		}
+	}
+
+	f := format.New(&output{Writer: out, Width: 80}, q)
+	err = formatEntries(out, f, result)
+	if out != os.Stdout {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+var filterOpts struct {
+	IgnoreCase    bool
+	IgnoreAccents bool
+	From          string
+	To            string
+	On            string
+	Last          int
+	Starred       bool
+	Tags          stringList
+}
+
+// A stringList is a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// setFilterFlags registers the flags that select entries
+func setFilterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&filterOpts.IgnoreCase, "ignore_case", false, "Ignore differences in case when searching")
+	fs.BoolVar(&filterOpts.IgnoreAccents, "ignore_accents", false, "Ignore accents and other diacritics when searching")
+	fs.StringVar(&filterOpts.From, "from", "", "Only include entries on or after this date")
+	fs.StringVar(&filterOpts.To, "to", "", "Only include entries on or before this date")
+	fs.StringVar(&filterOpts.On, "on", "", "Only include entries on this day")
+	fs.IntVar(&filterOpts.Last, "n", 0, "Only include the last `N` matching entries")
+	fs.BoolVar(&filterOpts.Starred, "starred", false, "Only include starred entries")
+	fs.Var(&filterOpts.Tags, "tag", "Only include entries with this `@tag` (may be repeated)")
+}
+
+// buildQuery creates a query from the filter flags and the search terms
+func buildQuery(command string, terms []string) (journal.Query, error) {
+	q := journal.Query{
+		Terms: terms,
+		Folding: journal.Folding{
+			IgnoreCase:    filterOpts.IgnoreCase,
+			IgnoreAccents: filterOpts.IgnoreAccents,
+		},
+		Starred: filterOpts.Starred,
+		Tags:    filterOpts.Tags,
+	}
+
+	if filterOpts.On != "" {
+		if filterOpts.From != "" || filterOpts.To != "" {
+			return q, usagef(command, "-on can't be combined with -from or -to")
+		}
+		day, err := parseDay(filterOpts.On)
+		if err != nil {
+			return q, usagef(command, "-on: %v", err)
+		}
+		q.From, q.To = dayRange(day)
+	}
+	if filterOpts.From != "" {
+		t, dayOnly, err := parseTime(filterOpts.From)
+		if err != nil {
+			return q, usagef(command, "-from: %v", err)
+		}
+		if dayOnly {
+			t, _ = dayRange(t)
+		}
+		q.From = t
+	}
+	if filterOpts.To != "" {
+		t, dayOnly, err := parseTime(filterOpts.To)
+		if err != nil {
+			return q, usagef(command, "-to: %v", err)
+		}
+		if dayOnly {
+			// Include the entire day
+			_, t = dayRange(t)
+		} else {
+			t = t.Add(time.Minute)
+		}
+		q.To = t
+	}
+	if filterOpts.Last < 0 {
+		return q, usagef(command, "-n should not be negative")
+	}
+
+	return q, nil
+}
+
+// findEntries searches the journal using the query built from the filter flags
+func findEntries(command string, terms []string) (chan *journal.Entry, journal.Query, error) {
+	q, err := buildQuery(command, terms)
+	if err != nil {
+		return nil, q, err
+	}
+
+	result, err := journal.Find(*journal_file, q)
+	if err != nil {
+		return nil, q, err
+	}
+
+	if filterOpts.Last > 0 {
+		result = lastEntries(result, filterOpts.Last)
+	}
+	return result, q, nil
+}
+
+// lastEntries retains only the last n entries in a stream of entries. The
+// buffer grows as entries arrive, so a large n costs no more than the journal
+// itself.
+func lastEntries(entries chan *journal.Entry, n int) chan *journal.Entry {
+	rv := make(chan *journal.Entry)
+	go func() {
+		// buf is a ring buffer; once full, next is the oldest entry
+		var buf []*journal.Entry
+		next := 0
+		for e := range entries {
+			if len(buf) < n {
+				buf = append(buf, e)
+			} else if n > 0 {
+				buf[next] = e
+				next = (next + 1) % n
+			}
+		}
+		for i := range buf {
+			rv <- buf[(next+i)%len(buf)]
+		}
+		close(rv)
+	}()
+	return rv
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+var followCommand = &command{
+	Name:    "follow",
+	Args:    "[TERM...]",
+	Summary: "Print new entries as they are added",
+	Help: `
+Wait for new entries to be added to the journal, and print them as they come
+in, like 'tail -f'. This works for entries added by jrnl, journal-server, or
+by editing the file, and keeps working if the journal file is replaced.
+
+If search terms are given, only new entries containing all terms are shown.
+The same filters as in 'jrnl search' can be used as well. Use -n to start by
+showing the last N matching entries. Press Ctrl+C to stop.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		setFilterFlags(fs)
+		setOutputFlags(fs)
+	},
+	Run: runFollow,
+}
+
+// followInterval is how often the journal file is checked for changes
+const followInterval = 500 * time.Millisecond
+
+// entryKey identifies an entry, regardless of where it is in the file
+type entryKey struct {
+	Date     time.Time
+	Starred  bool
+	Contents string
+}
+
+func keyOf(e *journal.Entry) entryKey {
+	return entryKey{e.Date, e.Starred, e.Contents}
+}
+
+func runFollow(fs *flag.FlagSet) error {
+	q, err := buildQuery("follow", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// The output never ends, so a pager would only get in the way
+	outputOpts.NoPager = true
+	out, format, err := openOutput("follow")
+	if err != nil {
+		return err
+	}
+	if format == "json" || format == "count" {
+		return usagef("follow", "the %s format can't be used to follow the journal; try ndjson", format)
+	}
+	f := formatters[format].New(out, q)
+
+	fi, err := os.Stat(*journal_file)
+	if err != nil {
+		return err
+	}
+	seen, err := readAllEntries(*journal_file)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Begin(out); err != nil {
+		return err
+	}
+
+	if filterOpts.Last > 0 {
+		var matching []*journal.Entry
+		for _, e := range seen {
+			if q.Match(e) {
+				matching = append(matching, e)
+			}
+		}
+		if len(matching) > filterOpts.Last {
+			matching = matching[len(matching)-filterOpts.Last:]
+		}
+		for _, e := range matching {
+			if err := f.Entry(out, e); err != nil {
+				return followError(err)
+			}
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	changed := false
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+
+		// The file may be missing briefly while it's being replaced
+		cur, err := os.Stat(*journal_file)
+		if err != nil {
+			continue
+		}
+
+		// Wait for the file to stop changing before reading it, so entries
+		// aren't read while they're being written.
+		if !os.SameFile(fi, cur) || cur.Size() != fi.Size() || !cur.ModTime().Equal(fi.ModTime()) {
+			fi = cur
+			changed = true
+			continue
+		}
+		if !changed {
+			continue
+		}
+		changed = false
+
+		entries, err := readAllEntries(*journal_file)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range newEntries(seen, entries) {
+			if q.Match(e) {
+				if err := f.Entry(out, e); err != nil {
+					return followError(err)
+				}
+			}
+		}
+		seen = entries
+	}
+}
+
+// readAllEntries reads all entries in the journal
+func readAllEntries(filename string) ([]*journal.Entry, error) {
+	all, err := journal.Find(filename, journal.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*journal.Entry
+	for e := range all {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// newEntries returns the entries in cur that weren't in old, in the order of
+// the file. Entries whose contents were edited in the mean time (for example
+// by renaming a tag) are matched up by their date, and don't count as new.
+func newEntries(old, cur []*journal.Entry) []*journal.Entry {
+	unchanged := make(map[entryKey]int)
+	for _, e := range old {
+		unchanged[keyOf(e)]++
+	}
+
+	var unmatched []*journal.Entry
+	for _, e := range cur {
+		k := keyOf(e)
+		if unchanged[k] > 0 {
+			unchanged[k]--
+		} else {
+			unmatched = append(unmatched, e)
+		}
+	}
+
+	// Any old entries left over may have been edited
+	edited := make(map[time.Time]int)
+	for k, n := range unchanged {
+		edited[k.Date] += n
+	}
+
+	var rv []*journal.Entry
+	for _, e := range unmatched {
+		if edited[e.Date] > 0 {
+			edited[e.Date]--
+		} else {
+			rv = append(rv, e)
+		}
+	}
+	return rv
+}
+
+// followError ignores errors caused by the reader going away
+func followError(err error) error {
+	if errors.Is(err, syscall.EPIPE) {
+		return nil
+	}
+	return err
+}
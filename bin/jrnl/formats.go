@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+// A formatter writes a stream of entries in a specific format
+type formatter interface {
+	// Begin is called before the first entry
+	Begin(w io.Writer) error
+
+	// Entry writes a single entry
+	Entry(w io.Writer, e *journal.Entry) error
+
+	// End is called after the last entry. n is the number of entries written.
+	End(w io.Writer, n int) error
+}
+
+// A formatterInfo describes an output format
+type formatterInfo struct {
+	Description string
+
+	// New creates a formatter for writing to out. q is the query that
+	// selected the entries.
+	New func(out *output, q journal.Query) formatter
+}
+
+var formatters = map[string]formatterInfo{
+	"journal": {
+		"The journal file format",
+		func(out *output, q journal.Query) formatter { return &journalFormatter{} },
+	},
+	"pretty": {
+		"Formatted for reading on a terminal",
+		func(out *output, q journal.Query) formatter {
+			return &prettyFormatter{p: prettyPrinter{Width: out.Width, Colour: out.Colour, Query: q}}
+		},
+	},
+	"json": {
+		"A JSON array of entries",
+		func(out *output, q journal.Query) formatter { return &jsonFormatter{} },
+	},
+	"ndjson": {
+		"One JSON object per line",
+		func(out *output, q journal.Query) formatter { return &jsonFormatter{lines: true} },
+	},
+	"csv": {
+		"Comma-separated values, with a header row",
+		func(out *output, q journal.Query) formatter { return &csvFormatter{} },
+	},
+	"markdown": {
+		"A Markdown document with a heading for each entry",
+		func(out *output, q journal.Query) formatter { return &markdownFormatter{} },
+	},
+	"count": {
+		"Only the number of entries",
+		func(out *output, q journal.Query) formatter { return countFormatter{} },
+	},
+	"dates": {
+		"Only the date of each entry",
+		func(out *output, q journal.Query) formatter { return datesFormatter{} },
+	},
+}
+
+// formatNames lists all output formats
+func formatNames() []string {
+	var rv []string
+	for name := range formatters {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// journalFormatter writes entries in the journal format
+type journalFormatter struct {
+	first bool
+}
+
+func (f *journalFormatter) Begin(w io.Writer) error {
+	f.first = true
+	return nil
+}
+
+func (f *journalFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	if !f.first {
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+	f.first = false
+	return e.Serialize(w)
+}
+
+func (f *journalFormatter) End(w io.Writer, n int) error {
+	return nil
+}
+
+// prettyFormatter writes entries for reading on a terminal
+type prettyFormatter struct {
+	p     prettyPrinter
+	first bool
+}
+
+func (f *prettyFormatter) Begin(w io.Writer) error {
+	f.first = true
+	return nil
+}
+
+func (f *prettyFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	if !f.first {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	f.first = false
+	return f.p.Print(w, e)
+}
+
+func (f *prettyFormatter) End(w io.Writer, n int) error {
+	return nil
+}
+
+// jsonEntry is the JSON representation of an entry
+type jsonEntry struct {
+	Date     string   `json:"date"`
+	Starred  bool     `json:"starred"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	Contents string   `json:"contents"`
+}
+
+func newJSONEntry(e *journal.Entry) jsonEntry {
+	tags := e.Tags()
+	if tags == nil {
+		tags = []string{}
+	}
+	return jsonEntry{
+		Date:     e.Date.Format(time.RFC3339),
+		Starred:  e.Starred,
+		Title:    e.Title(),
+		Tags:     tags,
+		Contents: e.Contents,
+	}
+}
+
+// jsonFormatter writes entries as a JSON array, or as newline-delimited JSON
+type jsonFormatter struct {
+	lines bool
+	first bool
+}
+
+func (f *jsonFormatter) Begin(w io.Writer) error {
+	f.first = true
+	if f.lines {
+		return nil
+	}
+	_, err := io.WriteString(w, "[")
+	return err
+}
+
+func (f *jsonFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	b, err := json.Marshal(newJSONEntry(e))
+	if err != nil {
+		return err
+	}
+
+	if f.lines {
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+
+	sep := ",\n"
+	if f.first {
+		sep = "\n"
+	}
+	f.first = false
+	_, err = io.WriteString(w, sep+string(b))
+	return err
+}
+
+func (f *jsonFormatter) End(w io.Writer, n int) error {
+	if f.lines {
+		return nil
+	}
+	if n > 0 {
+		_, err := io.WriteString(w, "\n]\n")
+		return err
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// csvFormatter writes entries as comma-separated values
+type csvFormatter struct {
+	cw *csv.Writer
+}
+
+func (f *csvFormatter) Begin(w io.Writer) error {
+	f.cw = csv.NewWriter(w)
+	return f.cw.Write([]string{"date", "starred", "title", "tags", "contents"})
+}
+
+func (f *csvFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	starred := "0"
+	if e.Starred {
+		starred = "1"
+	}
+	return f.cw.Write([]string{
+		e.Date.Format(time.RFC3339),
+		starred,
+		e.Title(),
+		strings.Join(e.Tags(), " "),
+		e.Contents,
+	})
+}
+
+func (f *csvFormatter) End(w io.Writer, n int) error {
+	f.cw.Flush()
+	return f.cw.Error()
+}
+
+// markdownFormatter writes entries as a Markdown document
+type markdownFormatter struct{}
+
+func (*markdownFormatter) Begin(w io.Writer) error {
+	return nil
+}
+
+func (*markdownFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	star := ""
+	if e.Starred {
+		star = " ★"
+	}
+	_, err := fmt.Fprintf(w, "## %s%s %s\n\n", e.Date.Format("2006-01-02 15:04"), star, e.Title())
+	if err != nil {
+		return err
+	}
+
+	if body := strings.TrimSpace(e.Body()); body != "" {
+		_, err = fmt.Fprintf(w, "%s\n\n", body)
+	}
+	return err
+}
+
+func (*markdownFormatter) End(w io.Writer, n int) error {
+	return nil
+}
+
+// countFormatter only writes the number of entries
+type countFormatter struct{}
+
+func (countFormatter) Begin(w io.Writer) error {
+	return nil
+}
+
+func (countFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	return nil
+}
+
+func (countFormatter) End(w io.Writer, n int) error {
+	_, err := fmt.Fprintf(w, "%d\n", n)
+	return err
+}
+
+// datesFormatter only writes the date of each entry
+type datesFormatter struct{}
+
+func (datesFormatter) Begin(w io.Writer) error {
+	return nil
+}
+
+func (datesFormatter) Entry(w io.Writer, e *journal.Entry) error {
+	_, err := fmt.Fprintf(w, "%s\n", e.Date.Format("2006-01-02 15:04"))
+	return err
+}
+
+func (datesFormatter) End(w io.Writer, n int) error {
+	return nil
+}
@@ -0,0 +1,51 @@
+// Client-side search through the journal. The search index is loaded from
+// search-index.js, so this also works when the site is opened from disk.
+(function() {
+	const fold = s => s.normalize("NFD").replace(/\p{M}/gu, "").toLowerCase();
+
+	const entries = (window.searchIndex || []).map(e => ({...e, folded: fold(e.x)}));
+	const input = document.getElementById("search");
+	const results = document.getElementById("search-results");
+	const archive = document.getElementById("archive");
+
+	const MAX_RESULTS = 200;
+
+	function search() {
+		const terms = fold(input.value).split(/\s+/).filter(t => t != "");
+		results.innerHTML = "";
+		archive.hidden = terms.length > 0;
+		if (terms.length == 0) {
+			return;
+		}
+
+		let n = 0;
+		for (let i = entries.length - 1; i >= 0; i--) {
+			const e = entries[i];
+			if (!terms.every(t => e.folded.includes(t))) {
+				continue;
+			}
+			n++;
+			if (n > MAX_RESULTS) {
+				continue;
+			}
+
+			const li = document.createElement("li");
+			const a = document.createElement("a");
+			a.href = e.u;
+			a.textContent = e.d;
+			li.append(a, (e.s ? " ★ " : " ") + e.t);
+			results.append(li);
+		}
+
+		if (n == 0) {
+			results.textContent = "No matching entries";
+		} else if (n > MAX_RESULTS) {
+			const li = document.createElement("li");
+			li.textContent = "… and " + (n - MAX_RESULTS) + " more";
+			results.append(li);
+		}
+	}
+
+	input.addEventListener("input", search);
+	search();
+})();
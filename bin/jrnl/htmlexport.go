@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+// htmlAssets holds the templates and static files for the HTML export
+//
+//go:embed html
+var htmlAssets embed.FS
+
+// An htmlSite is a static website containing the journal
+type htmlSite struct {
+	// Dir is the directory the site is written to
+	Dir string
+
+	// AttachmentsDir is the directory containing attached files. If it is
+	// empty, attachments are not included.
+	AttachmentsDir string
+
+	tpl    *template.Template
+	days   []*htmlDay
+	dayMap map[string]*htmlDay
+	tags   map[string]*htmlTag
+
+	// attachments holds the attachments that have been copied into the site
+	attachments map[string]htmlAttachment
+}
+
+// An htmlAttachment is an attached file in the site
+type htmlAttachment struct {
+	// File is the file name relative to the site root, or the empty string if
+	// the attachment isn't available
+	File string
+
+	// Image is set if the file is an image
+	Image bool
+}
+
+// An htmlDay is a page containing all entries on a single day
+type htmlDay struct {
+	Date    time.Time
+	Entries []*htmlEntry
+}
+
+func (d *htmlDay) URL() string {
+	return d.Date.Format("2006/01/02") + ".html"
+}
+
+type htmlEntry struct {
+	*journal.Entry
+
+	// ID is the entry's anchor on the day page
+	ID string
+
+	// URL is the link to this entry, relative to the site root
+	URL string
+
+	// HTML is the formatted contents
+	HTML template.HTML
+}
+
+// An htmlTag is a page listing all entries with a tag. Tags that only differ
+// in case share a page, as not all file systems can tell them apart.
+type htmlTag struct {
+	Names   []string
+	Entries []*htmlEntry
+}
+
+func (t *htmlTag) Name() string {
+	return strings.Join(t.Names, " ")
+}
+
+func (t *htmlTag) URL() string {
+	return tagFileName(t.Names[0])
+}
+
+// tagFileName returns the name of the page for a tag
+func tagFileName(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "@")) + ".html"
+}
+
+// exportHTML writes all entries to a static website in dir
+func exportHTML(dir string, entries chan *journal.Entry) error {
+	tpl, err := template.ParseFS(htmlAssets, "html/site.html")
+	if err != nil {
+		drain(entries)
+		return err
+	}
+
+	site := &htmlSite{
+		Dir:            dir,
+		AttachmentsDir: *attachments_dir,
+		tpl:            tpl,
+		dayMap:         make(map[string]*htmlDay),
+		tags:           make(map[string]*htmlTag),
+		attachments:    make(map[string]htmlAttachment),
+	}
+
+	n := 0
+	for e := range entries {
+		site.add(e)
+		n++
+	}
+	if n == 0 {
+		return errNoEntries
+	}
+
+	return site.write()
+}
+
+// add adds e to the day page and the tag pages it belongs on
+func (s *htmlSite) add(e *journal.Entry) {
+	key := e.Date.Format("2006-01-02")
+	day := s.dayMap[key]
+	if day == nil {
+		y, m, d := e.Date.Date()
+		day = &htmlDay{Date: time.Date(y, m, d, 0, 0, 0, 0, e.Date.Location())}
+		s.days = append(s.days, day)
+		s.dayMap[key] = day
+	}
+
+	he := &htmlEntry{
+		Entry: e,
+		ID:    fmt.Sprintf("e%s-%d", e.Date.Format("1504"), len(day.Entries)+1),
+	}
+	he.URL = day.URL() + "#" + he.ID
+	day.Entries = append(day.Entries, he)
+
+	for _, tag := range e.Tags() {
+		if tag == "@attachment" {
+			// Attachments are shown in the entry itself
+			continue
+		}
+		key := strings.ToLower(tag)
+		t := s.tags[key]
+		if t == nil {
+			t = &htmlTag{}
+			s.tags[key] = t
+		}
+		if !containsString(t.Names, tag) {
+			t.Names = append(t.Names, tag)
+		}
+		t.Entries = append(t.Entries, he)
+	}
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes all pages to disk
+func (s *htmlSite) write() error {
+	// Entries may not be in order if the journal file was edited by hand
+	sort.SliceStable(s.days, func(i, j int) bool {
+		return s.days[i].Date.Before(s.days[j].Date)
+	})
+	for _, d := range s.days {
+		sort.SliceStable(d.Entries, func(i, j int) bool {
+			return d.Entries[i].Date.Before(d.Entries[j].Date)
+		})
+	}
+
+	for _, d := range s.days {
+		for _, e := range d.Entries {
+			contents, err := s.formatContents(e.Entry, "../../")
+			if err != nil {
+				return err
+			}
+			e.HTML = contents
+		}
+	}
+
+	for i, d := range s.days {
+		data := struct {
+			Title, Root string
+			Prev, Next  string
+			Entries     []*htmlEntry
+		}{
+			Title:   d.Date.Format("Monday 2 January 2006"),
+			Root:    "../../",
+			Entries: d.Entries,
+		}
+		if i > 0 {
+			data.Prev = s.days[i-1].URL()
+		}
+		if i+1 < len(s.days) {
+			data.Next = s.days[i+1].URL()
+		}
+		if err := s.writePage(d.URL(), "day", data); err != nil {
+			return err
+		}
+	}
+
+	if err := s.writeTags(); err != nil {
+		return err
+	}
+	if err := s.writeIndex(); err != nil {
+		return err
+	}
+	if err := s.writeSearchIndex(); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"style.css", "search.js"} {
+		b, err := htmlAssets.ReadFile("html/" + name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(s.Dir, name), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type htmlYear struct {
+	Year   int
+	Months []*htmlMonth
+}
+
+type htmlMonth struct {
+	Name string
+	Days []htmlDayLink
+}
+
+type htmlDayLink struct {
+	URL     string
+	Day     int
+	Entries int
+	Starred bool
+}
+
+// writeIndex writes the main page, with links to all days by year and month
+func (s *htmlSite) writeIndex() error {
+	var years []*htmlYear
+	for i := len(s.days) - 1; i >= 0; i-- {
+		d := s.days[i]
+		if len(years) == 0 || years[len(years)-1].Year != d.Date.Year() {
+			years = append(years, &htmlYear{Year: d.Date.Year()})
+		}
+		y := years[len(years)-1]
+
+		month := d.Date.Format("January")
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Name != month {
+			y.Months = append(y.Months, &htmlMonth{Name: month})
+		}
+		m := y.Months[len(y.Months)-1]
+
+		link := htmlDayLink{URL: d.URL(), Day: d.Date.Day(), Entries: len(d.Entries)}
+		for _, e := range d.Entries {
+			link.Starred = link.Starred || e.Starred
+		}
+		m.Days = append(m.Days, link)
+	}
+
+	// Days are listed from old to new within a month
+	for _, y := range years {
+		for _, m := range y.Months {
+			for i, j := 0, len(m.Days)-1; i < j; i, j = i+1, j-1 {
+				m.Days[i], m.Days[j] = m.Days[j], m.Days[i]
+			}
+		}
+	}
+
+	return s.writePage("index.html", "index", struct {
+		Title, Root string
+		Years       []*htmlYear
+	}{"Journal", "", years})
+}
+
+// writeTags writes the tag index, and a page for each tag
+func (s *htmlSite) writeTags() error {
+	var tags []*htmlTag
+	for _, t := range s.tags {
+		tags = append(tags, t)
+		err := s.writePage(filepath.Join("tags", t.URL()), "tag", struct {
+			Title, Root string
+			Entries     []*htmlEntry
+		}{t.Name(), "../", t.Entries})
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Names[0]) < strings.ToLower(tags[j].Names[0])
+	})
+
+	type tagLink struct {
+		Name, URL string
+		Count     int
+	}
+	var links []tagLink
+	for _, t := range tags {
+		links = append(links, tagLink{t.Name(), t.URL(), len(t.Entries)})
+	}
+	return s.writePage(filepath.Join("tags", "index.html"), "tags", struct {
+		Title, Root string
+		Tags        []tagLink
+	}{"Tags", "../", links})
+}
+
+// writeSearchIndex writes the index used by search.js. It's a script rather
+// than a JSON file, so it can be loaded from a local file.
+func (s *htmlSite) writeSearchIndex() error {
+	type indexEntry struct {
+		URL     string `json:"u"`
+		Date    string `json:"d"`
+		Title   string `json:"t"`
+		Starred bool   `json:"s,omitempty"`
+		Text    string `json:"x"`
+	}
+
+	var index []indexEntry
+	for _, d := range s.days {
+		for _, e := range d.Entries {
+			index = append(index, indexEntry{e.URL, e.Date.Format("2006-01-02 15:04"), e.Title(), e.Starred, e.Contents})
+		}
+	}
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("window.searchIndex = ")
+	buf.Write(b)
+	buf.WriteString(";\n")
+	return os.WriteFile(filepath.Join(s.Dir, "search-index.js"), buf.Bytes(), 0644)
+}
+
+// writePage executes the template tpl, and writes the result to name
+func (s *htmlSite) writePage(name, tpl string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := s.tpl.ExecuteTemplate(&buf, tpl, data); err != nil {
+		return err
+	}
+
+	filename := filepath.Join(s.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// formatContents formats the contents of an entry as HTML. Tags link to their
+// tag page, and attachments are linked, or shown if they're images. root is
+// the path from the page to the site root.
+func (s *htmlSite) formatContents(e *journal.Entry, root string) (template.HTML, error) {
+	attached := make(map[string]bool)
+	for _, hash := range e.Attachments() {
+		attached[hash] = true
+	}
+
+	var b strings.Builder
+	for i, line := range strings.Split(e.Contents, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		if hash := strings.TrimSpace(strings.TrimPrefix(line, "@attachment ")); strings.HasPrefix(line, "@attachment ") && attached[hash] {
+			att, err := s.copyAttachment(hash)
+			if err != nil {
+				return "", err
+			}
+			if att.File == "" {
+				b.WriteString(html.EscapeString(line))
+			} else if att.Image {
+				fmt.Fprintf(&b, `<figure><a href="%s%s"><img src="%s%s" alt="" loading="lazy" /></a></figure>`, root, att.File, root, att.File)
+			} else {
+				fmt.Fprintf(&b, `<a href="%s%s">%s</a>`, root, att.File, html.EscapeString(line))
+			}
+			continue
+		}
+
+		if i == 0 {
+			b.WriteString(`<span class="title">`)
+		}
+		last := 0
+		for _, loc := range journal.FindTags(line) {
+			tag := line[loc[0]:loc[1]]
+			b.WriteString(html.EscapeString(line[last:loc[0]]))
+			fmt.Fprintf(&b, `<a href="%stags/%s">%s</a>`, root, tagFileName(tag), html.EscapeString(tag))
+			last = loc[1]
+		}
+		b.WriteString(html.EscapeString(line[last:]))
+		if i == 0 {
+			b.WriteString(`</span>`)
+		}
+	}
+
+	return template.HTML(b.String()), nil
+}
+
+// attachmentExtensions are the file extensions used for attachments in the
+// site. HTML files are saved as text, so they can't run scripts.
+var attachmentExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"application/ogg": ".ogg",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+	"text/plain":      ".txt",
+	"text/html":       ".txt",
+	"text/xml":        ".txt",
+}
+
+// copyAttachment copies an attached file into the site. The file gets an
+// extension that matches its contents, so browsers know how to open it.
+func (s *htmlSite) copyAttachment(hash string) (htmlAttachment, error) {
+	if att, ok := s.attachments[hash]; ok {
+		return att, nil
+	}
+
+	var att htmlAttachment
+	if s.AttachmentsDir == "" {
+		s.attachments[hash] = att
+		return att, nil
+	}
+
+	src := filepath.Join(s.AttachmentsDir, hash)
+	f, err := os.Open(src)
+	if os.IsNotExist(err) {
+		s.attachments[hash] = att
+		return att, nil
+	} else if err != nil {
+		return att, err
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	file := "attachments/" + hash + attachmentExtensions[contentType]
+	if err := copyFile(src, filepath.Join(s.Dir, filepath.FromSlash(file)), 0644); err != nil {
+		return att, err
+	}
+
+	att = htmlAttachment{File: file, Image: strings.HasPrefix(contentType, "image/")}
+	s.attachments[hash] = att
+	return att, nil
+}
@@ -1,71 +1,330 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"github.com/thijzert/go-journal"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 var (
-	journal_file = flag.String("journal_file", "journal.txt", "Journal File")
-	act_create   = flag.Bool("create", false, "Create a new entry")
-	act_search   = flag.Bool("search", false, "Search the journal for entries matching these tags")
-	date         = flag.String("date", "", "Date/time of new entry")
+	journal_file    = flag.String("journal_file", "journal.txt", "Journal File")
+	journal_name    = flag.String("journal", "", "Use the named journal NAME.txt in the journals directory")
+	journals_dir    = flag.String("journals_dir", "", "Directory with named journals (default: the directory of the journal file)")
+	projects_dir    = flag.String("projects_dir", "", "Directory with project log files")
+	attachments_dir = flag.String("attachments_dir", "", "Directory containing attached files")
+
+	// Legacy flags. These predate the subcommands, and are kept for compatibility.
+	act_create = flag.Bool("create", false, "Create a new entry (same as 'jrnl add')")
+	act_search = flag.Bool("search", false, "Search the journal for entries matching these tags (same as 'jrnl search')")
+	_          = flag.String("date", "", "Date/time of new entry")
+	_          = flag.Bool("ignore_case", false, "Ignore differences in case when searching")
+	_          = flag.Bool("ignore_accents", false, "Ignore accents and other diacritics when searching")
+)
+
+// Exit codes
+const (
+	exitOK        = 0
+	exitNoEntries = 1
+	exitUsage     = 2
+	exitFailure   = 3
 )
 
+// errNoEntries signals that a command completed successfully, but did not find any entries.
+var errNoEntries = errors.New("no matching entries")
+
+// A usageError indicates that the command was invoked incorrectly
+type usageError struct {
+	Command string
+	Message string
+}
+
+func (e usageError) Error() string {
+	return e.Message
+}
+
+func usagef(command string, format string, args ...interface{}) error {
+	return usageError{command, fmt.Sprintf(format, args...)}
+}
+
+// A command is a jrnl subcommand
+type command struct {
+	// Name is the name by which the command is invoked
+	Name string
+
+	// Args is a short synopsis of the positional arguments
+	Args string
+
+	// Summary is a one-line description, shown in the list of commands
+	Summary string
+
+	// Help is a longer description, shown in 'jrnl help COMMAND'
+	Help string
+
+	// Hidden commands are not shown in the list of commands
+	Hidden bool
+
+	// SetFlags registers the command's flags in fs
+	SetFlags func(fs *flag.FlagSet)
+
+	// Run executes the command. It receives the flag set after parsing.
+	Run func(fs *flag.FlagSet) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		addCommand,
+		searchCommand,
+		showCommand,
+		editCommand,
+		tagsCommand,
+		statsCommand,
+		exportCommand,
+		browseCommand,
+		calendarCommand,
+		followCommand,
+		completionCommand,
+		completeCommand,
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
 func main() {
+	flag.Usage = func() {
+		printUsage(os.Stderr)
+	}
 	flag.Parse()
 
-	if !*act_create && !*act_search {
-		panic("Specify at least one action (--create, --search, etc)")
+	err := run(flag.Args())
+	os.Exit(exitCode(err))
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
 	}
-	if *act_create && *act_search {
-		panic("Can't search and create a new entry.")
+	if errors.Is(err, errNoEntries) {
+		return exitNoEntries
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
 	}
 
-	if *act_create {
-		t := journal.SmartTime(*date)
-		c, _ := ioutil.ReadAll(os.Stdin)
-		// Remove trailing newlines from the contents
-		for len(c) > 0 && c[len(c)-1] == 0x0a {
-			c = c[0 : len(c)-1]
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		fmt.Fprintf(os.Stderr, "jrnl: %s\n", uerr.Message)
+		if uerr.Command != "" {
+			fmt.Fprintf(os.Stderr, "Run 'jrnl help %s' for usage.\n", uerr.Command)
+		} else {
+			fmt.Fprintf(os.Stderr, "Run 'jrnl help' for usage.\n")
 		}
-		// Remove carriage returns entirely. Why? Because it fits my use case, and because sod MS-DOS.
-		conts := strings.Replace(string(c), "\r", "", -1)
+		return exitUsage
+	}
 
-		e := &journal.Entry{
-			Date:     t,
-			Starred:  false,
-			Contents: conts}
+	fmt.Fprintf(os.Stderr, "jrnl: %s\n", humanError(err))
+	return exitFailure
+}
 
-		err := journal.Add(*journal_file, e)
-		if err != nil {
-			panic(err)
+// humanError rephrases common errors in a more readable way
+func humanError(err error) string {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		if errors.Is(err, os.ErrNotExist) {
+			if perr.Path == *journal_file {
+				return fmt.Sprintf("journal file '%s' does not exist. Use --journal_file to select another journal, or add an entry to create it.", perr.Path)
+			}
+			return fmt.Sprintf("%s: '%s' does not exist", perr.Op, perr.Path)
+		} else if errors.Is(err, os.ErrPermission) {
+			return fmt.Sprintf("permission denied: cannot %s '%s'", perr.Op, perr.Path)
 		}
 	}
-	if *act_search {
-		terms := flag.Args()
+	return err.Error()
+}
+
+func run(args []string) error {
+	var cmd *command
+	if *act_create && *act_search {
+		return usageError{"", "can't search and create a new entry at the same time"}
+	} else if *act_create {
+		cmd = addCommand
+		args = append(legacyArgs(cmd), args...)
+	} else if *act_search {
+		cmd = searchCommand
+		args = append(legacyArgs(cmd), args...)
+	} else {
+		if len(args) == 0 {
+			printUsage(os.Stderr)
+			return usageError{"", "no command specified"}
+		}
+		if args[0] == "help" {
+			return helpCommand(args[1:])
+		}
 
-		result, err := journal.Search(*journal_file, terms...)
-		if err != nil {
-			panic(err)
+		cmd = findCommand(args[0])
+		if cmd == nil {
+			return usageError{"", fmt.Sprintf("unknown command '%s'", args[0])}
 		}
-		var i int = 0
+		args = args[1:]
+	}
 
-		for e := range result {
-			// TODO: nicer formatting
-			// TODO: detect a pipe, and fall back to non-nice formatting.
-			if i > 0 {
-				os.Stdout.Write([]byte("\n"))
-			}
-			e.Serialize(os.Stdout)
-			i++
+	return runCommand(cmd, args)
+}
+
+// newFlagSet creates the flag set for cmd, including the global flags
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("jrnl "+cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	setGlobalFlags(fs)
+	if cmd.SetFlags != nil {
+		cmd.SetFlags(fs)
+	}
+	return fs
+}
+
+func runCommand(cmd *command, args []string) error {
+	fs := newFlagSet(cmd)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandUsage(os.Stdout, cmd)
+		return err
+	} else if err != nil {
+		return usageError{cmd.Name, err.Error()}
+	}
+
+	if *journal_name != "" {
+		*journal_file = namedJournal(*journal_name)
+	}
+
+	return cmd.Run(fs)
+}
+
+// setGlobalFlags registers the global flags in fs, so they can also be given
+// after the command name
+func setGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(journal_file, "journal_file", *journal_file, "Journal File")
+	fs.StringVar(journal_name, "journal", *journal_name, "Use the named journal NAME.txt in the journals directory")
+	fs.StringVar(journals_dir, "journals_dir", *journals_dir, "Directory with named journals (default: the directory of the journal file)")
+	fs.StringVar(projects_dir, "projects_dir", *projects_dir, "Directory with project log files")
+	fs.StringVar(attachments_dir, "attachments_dir", *attachments_dir, "Directory containing attached files")
+}
+
+// journalsDir returns the directory containing the named journals
+func journalsDir() string {
+	if *journals_dir != "" {
+		return *journals_dir
+	}
+	return filepath.Dir(*journal_file)
+}
+
+// namedJournal returns the file name of a named journal
+func namedJournal(name string) string {
+	return filepath.Join(journalsDir(), name+".txt")
+}
+
+// listJournals lists the names of all journals in the journals directory
+func listJournals() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(journalsDir(), "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, f := range files {
+		rv = append(rv, strings.TrimSuffix(filepath.Base(f), ".txt"))
+	}
+	return rv, nil
+}
+
+// legacyArgs translates the legacy flags passed to jrnl into flags for cmd
+func legacyArgs(cmd *command) []string {
+	fs := newFlagSet(cmd)
+	global := flag.NewFlagSet("", flag.ContinueOnError)
+	setGlobalFlags(global)
+
+	var rv []string
+	flag.Visit(func(f *flag.Flag) {
+		if global.Lookup(f.Name) != nil {
+			// Global flags have already been set
+			return
+		}
+		if fs.Lookup(f.Name) != nil {
+			rv = append(rv, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(rv, "--")
+}
+
+func helpCommand(args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return usageError{"", fmt.Sprintf("unknown help topic '%s'", args[0])}
+	}
+	printCommandUsage(os.Stdout, cmd)
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: jrnl [--journal_file FILE | --journal NAME] COMMAND [ARGUMENTS]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+
+	var visible []*command
+	for _, cmd := range commands {
+		if !cmd.Hidden {
+			visible = append(visible, cmd)
 		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		return visible[i].Name < visible[j].Name
+	})
+	for _, cmd := range visible {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.Name, cmd.Summary)
+	}
+
+	fmt.Fprintf(w, "\nRun 'jrnl help COMMAND' for more information on a command.\n")
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	fmt.Fprintf(w, "  --journal_file FILE\n\tRead and write journal entries from FILE (default %q)\n", *journal_file)
+	fmt.Fprintf(w, "  --journal NAME\n\tUse the named journal NAME.txt in the journals directory\n")
+	fmt.Fprintf(w, "  --journals_dir DIR\n\tDirectory with named journals (default: the directory of the journal file)\n")
+	fmt.Fprintf(w, "  --projects_dir DIR\n\tDirectory with project log files\n")
+	fmt.Fprintf(w, "  --attachments_dir DIR\n\tDirectory containing attached files\n")
+}
+
+func printCommandUsage(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, "Usage: jrnl %s [FLAGS] %s\n\n", cmd.Name, cmd.Args)
+	if cmd.Help != "" {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(cmd.Help))
+	} else {
+		fmt.Fprintf(w, "%s\n\n", cmd.Summary)
+	}
+
+	fs := newFlagSet(cmd)
+	fmt.Fprintf(w, "Flags:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
 
-		if i == 0 {
-			os.Exit(1)
+	if fs.Lookup("format") != nil {
+		fmt.Fprintf(w, "\nOutput formats:\n")
+		for _, name := range formatNames() {
+			fmt.Fprintf(w, "  %-10s %s\n", name, formatters[name].Description)
 		}
 	}
 }
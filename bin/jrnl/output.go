@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/thijzert/go-journal"
+	"golang.org/x/term"
+)
+
+var outputOpts struct {
+	Format    string
+	Plain     bool
+	NoPager   bool
+	Count     bool
+	DatesOnly bool
+}
+
+// setOutputFlags registers the flags that control output
+func setOutputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputOpts.Format, "format", "", "Output format: one of "+strings.Join(formatNames(), ", ")+" (default: pretty on a terminal, journal otherwise)")
+	fs.BoolVar(&outputOpts.Plain, "plain", false, "Print entries in the journal format, even on a terminal")
+	fs.BoolVar(&outputOpts.NoPager, "no_pager", false, "Don't page the output through $PAGER")
+	fs.BoolVar(&outputOpts.Count, "count", false, "Only print the number of entries (same as --format count)")
+	fs.BoolVar(&outputOpts.DatesOnly, "dates-only", false, "Only print the date of each entry (same as --format dates)")
+	fs.BoolVar(&outputOpts.DatesOnly, "dates_only", false, "Alias for --dates-only")
+}
+
+// outputFormat determines the output format from the command-line flags
+func outputFormat(command string, terminal bool) (string, error) {
+	format := outputOpts.Format
+	if outputOpts.Count && outputOpts.DatesOnly {
+		return "", usagef(command, "--count and --dates-only can't be combined")
+	} else if (outputOpts.Count || outputOpts.DatesOnly) && format != "" {
+		return "", usagef(command, "--format can't be combined with --count or --dates-only")
+	}
+
+	if outputOpts.Count {
+		format = "count"
+	} else if outputOpts.DatesOnly {
+		format = "dates"
+	} else if format == "" && outputOpts.Plain {
+		format = "journal"
+	} else if format == "" && terminal {
+		format = "pretty"
+	} else if format == "" {
+		format = "journal"
+	}
+
+	if _, ok := formatters[format]; !ok {
+		return "", usagef(command, "unknown output format '%s'", format)
+	}
+	return format, nil
+}
+
+// An output is the destination for command output. If stdout is a terminal,
+// pretty output is sent through a pager.
+type output struct {
+	io.Writer
+
+	// Colour is set if the terminal supports colours
+	Colour bool
+
+	// Width is the width of the terminal, in columns
+	Width int
+
+	pager *exec.Cmd
+	pipe  io.WriteCloser
+}
+
+// openOutput prepares stdout for writing entries in the format selected on
+// the command line
+func openOutput(command string) (*output, string, error) {
+	rv := &output{Writer: os.Stdout, Width: 80}
+
+	fd := int(os.Stdout.Fd())
+	terminal := term.IsTerminal(fd)
+	format, err := outputFormat(command, terminal)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !terminal || format != "pretty" {
+		return rv, format, nil
+	}
+
+	rv.Colour = colourEnabled()
+	if w, _, err := term.GetSize(fd); err == nil && w > 20 {
+		rv.Width = w
+	}
+
+	if !outputOpts.NoPager {
+		rv.startPager()
+	}
+
+	return rv, format, nil
+}
+
+// colourEnabled checks if the user is OK with colours on their terminal
+func colourEnabled() bool {
+	return os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// startPager starts $PAGER, and redirects all output to it. If the pager
+// can't be started, output is written to stdout directly.
+func (o *output) startPager() {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	if pager[0] == "cat" {
+		return
+	}
+
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// Quit if the output fits on one screen, and pass colours through
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
+	}
+
+	o.Writer = pipe
+	o.pager = cmd
+	o.pipe = pipe
+}
+
+// Close waits for the pager to exit, if there is one
+func (o *output) Close() error {
+	if o.pager == nil {
+		return nil
+	}
+
+	o.pipe.Close()
+	err := o.pager.Wait()
+	o.pager = nil
+	o.Writer = os.Stdout
+	return err
+}
+
+// printEntries shows all entries on stdout, in the format selected on the
+// command line. Search terms in q are highlighted where possible. It returns
+// errNoEntries if there weren't any.
+func printEntries(command string, entries chan *journal.Entry, q journal.Query) error {
+	out, format, err := openOutput(command)
+	if err != nil {
+		drain(entries)
+		return err
+	}
+
+	f := formatters[format].New(out, q)
+	err = formatEntries(out, f, entries)
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if errors.Is(err, syscall.EPIPE) {
+		// The pager was closed before reading everything
+		err = nil
+	}
+	return err
+}
+
+// formatEntries writes all entries to w using the formatter f. It returns
+// errNoEntries if there weren't any.
+func formatEntries(w io.Writer, f formatter, entries chan *journal.Entry) error {
+	var n int = 0
+	err := f.Begin(w)
+
+	for e := range entries {
+		if err != nil {
+			// Drain the channel, so the reading goroutine can finish
+			continue
+		}
+
+		err = f.Entry(w, e)
+		n++
+	}
+
+	if err == nil {
+		err = f.End(w, n)
+	}
+
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNoEntries
+	}
+	return nil
+}
+
+// drain discards all remaining entries
+func drain(entries chan *journal.Entry) {
+	for range entries {
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thijzert/go-journal"
+)
+
+// ANSI escape sequences used in pretty output
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDate      = "\x1b[34m"
+	ansiStar      = "\x1b[33m"
+	ansiTag       = "\x1b[36m"
+	ansiHighlight = "\x1b[1;30;43m"
+)
+
+// A prettyPrinter formats entries for reading on a terminal
+type prettyPrinter struct {
+	Width  int
+	Colour bool
+
+	// Query is used to highlight search terms
+	Query journal.Query
+}
+
+func (p prettyPrinter) style(w io.Writer, style, text string) {
+	if p.Colour && style != "" {
+		io.WriteString(w, style+text+ansiReset)
+	} else {
+		io.WriteString(w, text)
+	}
+}
+
+// Print writes e to w
+func (p prettyPrinter) Print(w io.Writer, e *journal.Entry) error {
+	header := e.Date.Format("2006-01-02 15:04")
+	p.style(w, ansiDate, header)
+	if e.Starred {
+		io.WriteString(w, " ")
+		p.style(w, ansiStar, "★")
+		header += " *"
+	}
+	io.WriteString(w, " ")
+	header += " "
+
+	styles := p.styles(e.Contents)
+	lines := wrapLines(e.Contents, p.Width, utf8.RuneCountInString(header))
+	for i, ln := range lines {
+		if i > 0 {
+			io.WriteString(w, "\n")
+		}
+		p.printStyled(w, e.Contents, styles, ln[0], ln[1])
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// styles determines the style for every byte in text
+func (p prettyPrinter) styles(text string) []string {
+	rv := make([]string, len(text))
+	if !p.Colour {
+		return rv
+	}
+
+	title := strings.IndexByte(text, '\n')
+	if title == -1 {
+		title = len(text)
+	}
+	for i := 0; i < title; i++ {
+		rv[i] = ansiBold
+	}
+
+	for _, m := range journal.FindTags(text) {
+		for i := m[0]; i < m[1]; i++ {
+			rv[i] = ansiTag
+		}
+	}
+	for _, m := range p.Query.Matches(text) {
+		for i := m[0]; i < m[1]; i++ {
+			rv[i] = ansiHighlight
+		}
+	}
+	return rv
+}
+
+// printStyled writes text[start:end] to w, switching styles as needed
+func (p prettyPrinter) printStyled(w io.Writer, text string, styles []string, start, end int) {
+	for start < end {
+		run := start + 1
+		for run < end && styles[run] == styles[start] {
+			run++
+		}
+		p.style(w, styles[start], text[start:run])
+		start = run
+	}
+}
+
+// wrapLines splits text into lines of at most width characters, breaking at
+// spaces where possible. The first line is shortened by indent characters.
+// It returns the lines as pairs of byte offsets, excluding the line breaks.
+func wrapLines(text string, width, indent int) [][2]int {
+	var rv [][2]int
+
+	start := 0
+	avail := width - indent
+	for start <= len(text) {
+		nl := strings.IndexByte(text[start:], '\n')
+		end := len(text)
+		if nl != -1 {
+			end = start + nl
+		}
+
+		// Wrap this paragraph
+		for {
+			if avail < 10 {
+				avail = 10
+			}
+
+			cut, next := wrapPoint(text[start:end], avail)
+			if cut == -1 {
+				rv = append(rv, [2]int{start, end})
+				break
+			}
+			rv = append(rv, [2]int{start, start + cut})
+			start += next
+			avail = width
+		}
+
+		start = end + 1
+		avail = width
+	}
+
+	return rv
+}
+
+// wrapPoint finds where to break s so the first line is at most width
+// characters long. It returns -1 if s fits. Otherwise, it returns the end of
+// the first line, and the start of the second.
+func wrapPoint(s string, width int) (cut, next int) {
+	if utf8.RuneCountInString(s) <= width {
+		return -1, -1
+	}
+
+	lastSpace := -1
+	col := 0
+	for i, r := range s {
+		if r == ' ' {
+			lastSpace = i
+		}
+		if col == width {
+			if lastSpace > 0 {
+				return lastSpace, lastSpace + 1
+			}
+			// No spaces; break in the middle of the word
+			return i, i
+		}
+		col++
+	}
+	return -1, -1
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/thijzert/go-journal"
+)
+
+// Projects are log files in the projects directory. Entries added to a
+// project are tagged with '@project NAME', and are also appended to the
+// project's log file. This is the same layout that journal-server uses.
+
+// listProjects lists the file names of all projects in the projects directory
+func listProjects() ([]string, error) {
+	if *projects_dir == "" {
+		return nil, nil
+	}
+
+	fis, err := os.ReadDir(*projects_dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		rv = append(rv, fi.Name())
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+// findProject finds the log file for a project. name is either the file name,
+// or the file name without the extension.
+func findProject(name string) (string, error) {
+	if *projects_dir == "" {
+		return "", fmt.Errorf("no projects directory; use --projects_dir to set one")
+	}
+
+	projects, err := listProjects()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range projects {
+		if p == name || journal.StripProjectSuffix(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("project '%s' does not exist in '%s'", name, *projects_dir)
+}
+
+// addToProject tags e with the project, and appends it to the project's log file
+func addToProject(project string, e *journal.Entry) error {
+	f, err := os.OpenFile(filepath.Join(*projects_dir, project), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "\n=== %s ===\n%s\n", e.Date.Format("2006-01-02"), e.Contents)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Contents = "@project " + journal.ProjectName(project) + "\n" + e.Contents
+	return nil
+}
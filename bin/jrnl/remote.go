@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+// attachmentChunkSize is the size of the chunks in which attachments are
+// uploaded. This is the same as the web interface uses.
+const attachmentChunkSize = 125000
+
+// errAccessDenied is returned if the server doesn't accept the API key
+var errAccessDenied = errors.New("access denied by the server; check --key")
+
+// errAttachmentTooLarge is returned if the server doesn't accept an attachment
+// because of its size
+var errAttachmentTooLarge = errors.New("the attachment is too large for the server")
+
+// A remote is a journal-server that receives new entries
+type remote struct {
+	// URL is the address of the journal page, e.g. https://example.com/journal
+	URL string
+
+	// Key is the API key
+	Key string
+
+	// KeyParameter is the name of the query parameter containing the API key
+	KeyParameter string
+
+	// Offline is set once sending something failed. New entries are then
+	// queued straight away, so they stay in order.
+	Offline bool
+
+	client *http.Client
+}
+
+func newRemote(u, key, keyParameter string) (*remote, error) {
+	pu, err := url.Parse(u)
+	if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		return nil, fmt.Errorf("invalid remote URL '%s'", u)
+	}
+
+	return &remote{
+		URL:          strings.TrimRight(u, "/"),
+		Key:          key,
+		KeyParameter: keyParameter,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				// The server redirects back to the editor after saving. The
+				// redirect itself tells us if that worked.
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// endpoint returns the URL for path, relative to the journal page
+func (r *remote) endpoint(path string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set(r.KeyParameter, r.Key)
+	return r.URL + path + "?" + query.Encode()
+}
+
+// hideKey removes the URL, which contains the API key, from request errors
+func (r *remote) hideKey(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s %s: %w", uerr.Op, r.URL, uerr.Err)
+	}
+	return err
+}
+
+// A pendingEntry is an entry that is to be sent to a remote
+type pendingEntry struct {
+	// Remote is the URL of the remote that should receive this entry
+	Remote string `json:"remote"`
+
+	Date        time.Time `json:"date"`
+	Starred     bool      `json:"starred"`
+	Contents    string    `json:"contents"`
+	Project     string    `json:"project,omitempty"`
+	Attachments []string  `json:"attachments,omitempty"`
+
+	// file is the file name of the entry in the queue
+	file string
+}
+
+// Send posts e to the server, after uploading all its attachments from dir
+func (r *remote) Send(e pendingEntry, dir string) error {
+	for _, hash := range e.Attachments {
+		if err := r.upload(hash, filepath.Join(dir, hash)); err != nil {
+			return err
+		}
+	}
+
+	form := url.Values{}
+	form.Set("ts", e.Date.Format("2006-01-02 15:04"))
+	form.Set("body", e.Contents)
+	if e.Starred {
+		form.Set("star", "1")
+	}
+	if e.Project != "" {
+		form.Set("project", e.Project)
+	}
+	for _, hash := range e.Attachments {
+		form.Set("attachment-"+hash, "1")
+	}
+
+	resp, err := r.client.PostForm(r.endpoint("", nil), form)
+	if err != nil {
+		return r.hideKey(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusForbidden {
+		return errAccessDenied
+	} else if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf("unexpected response from server: %s", resp.Status)
+	}
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Query().Get("success") == "" {
+		return fmt.Errorf("the server could not save the entry")
+	}
+	return nil
+}
+
+// upload sends an attachment to the server in chunks
+func (r *remote) upload(hash, filename string) error {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("att_hash", hash)
+
+	// The server tells us how much of the file it has, so an upload that was
+	// interrupted continues where it left off.
+	complete := false
+	for offset := 0; !complete; {
+		end := offset + attachmentChunkSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+		query.Set("offset", strconv.Itoa(offset))
+
+		resp, err := r.client.Post(r.endpoint("/attachment", query), "application/octet-stream", bytes.NewReader(buf[offset:end]))
+		if err != nil {
+			return r.hideKey(err)
+		}
+
+		var result struct {
+			OK       int    `json:"ok"`
+			Error    int    `json:"error"`
+			Message  string `json:"_"`
+			Length   int    `json:"file_length"`
+			Complete bool   `json:"complete"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusForbidden {
+			return errAccessDenied
+		} else if resp.StatusCode == http.StatusRequestEntityTooLarge {
+			return errAttachmentTooLarge
+		} else if err != nil {
+			return fmt.Errorf("unexpected response from server: %s", resp.Status)
+		} else if result.OK != 1 && result.Error != http.StatusConflict {
+			return fmt.Errorf("error uploading attachment: %s", result.Message)
+		} else if result.Length > len(buf) || (result.OK == 1 && result.Length <= offset && !result.Complete) {
+			return fmt.Errorf("error uploading attachment: the server has %d bytes instead of %d", result.Length, end)
+		}
+
+		offset = result.Length
+		complete = result.Complete
+		if !complete && offset == len(buf) {
+			return fmt.Errorf("error uploading attachment: the server received a different file")
+		}
+	}
+	return nil
+}
+
+// The queue holds entries that could not be sent to a remote. Every entry is
+// a JSON file in the queue directory; attachments are stored in the
+// 'attachments' subdirectory under their SHA-256 hash.
+
+// defaultQueueDir returns the default location of the queue
+func defaultQueueDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".jrnl-queue"
+	}
+	return filepath.Join(dir, "jrnl", "queue")
+}
+
+// queueAttachmentsDir returns the directory for attachments in the queue
+func queueAttachmentsDir(queueDir string) string {
+	return filepath.Join(queueDir, "attachments")
+}
+
+// enqueue adds e to the queue
+func enqueue(queueDir string, e pendingEntry) error {
+	if err := os.MkdirAll(queueDir, 0700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Make sure entries are sent in the order in which they were added
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".json"
+
+	tmp := filepath.Join(queueDir, "."+name)
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(queueDir, name))
+}
+
+// queuedEntries lists the entries in the queue, oldest first
+func queuedEntries(queueDir string) ([]pendingEntry, error) {
+	files, err := filepath.Glob(filepath.Join(queueDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rv []pendingEntry
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var e pendingEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		e.file = f
+		rv = append(rv, e)
+	}
+	return rv, nil
+}
+
+// flushQueue sends all queued entries for r to the server. It stops at the
+// first error, so the order of entries is preserved. It returns the number of
+// entries sent.
+func flushQueue(queueDir string, r *remote) (int, error) {
+	entries, err := queuedEntries(queueDir)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	attDir := queueAttachmentsDir(queueDir)
+	for _, e := range entries {
+		if e.Remote != r.URL {
+			continue
+		}
+		if err := r.Send(e, attDir); err != nil {
+			r.Offline = true
+			return sent, err
+		}
+		if err := os.Remove(e.file); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		removeUnusedAttachments(queueDir)
+	}
+	return sent, nil
+}
+
+// removeUnusedAttachments deletes attachments from the queue that no queued
+// entry refers to
+func removeUnusedAttachments(queueDir string) {
+	entries, err := queuedEntries(queueDir)
+	if err != nil {
+		return
+	}
+	used := make(map[string]bool)
+	for _, e := range entries {
+		for _, hash := range e.Attachments {
+			used[hash] = true
+		}
+	}
+
+	files, _ := os.ReadDir(queueAttachmentsDir(queueDir))
+	for _, f := range files {
+		if !used[f.Name()] {
+			os.Remove(filepath.Join(queueAttachmentsDir(queueDir), f.Name()))
+		}
+	}
+}
+
+// sendOrQueue sends e to r. If that fails, the entry is queued, to be sent
+// the next time. Attachments are read from attDir.
+func sendOrQueue(queueDir string, r *remote, e *journal.Entry, project string, attachments []string, attDir string) error {
+	p := pendingEntry{
+		Remote:      r.URL,
+		Date:        e.Date,
+		Starred:     e.Starred,
+		Contents:    e.Contents,
+		Project:     project,
+		Attachments: attachments,
+	}
+
+	// Don't send anything if earlier entries are still waiting in the queue
+	var err error
+	if !r.Offline {
+		if err = r.Send(p, attDir); err == nil {
+			if len(attachments) > 0 {
+				removeUnusedAttachments(queueDir)
+			}
+			return nil
+		}
+		if errors.Is(err, errAttachmentTooLarge) {
+			// Sending it again won't help
+			return err
+		}
+		r.Offline = true
+	}
+
+	if qerr := queueEntry(queueDir, p, attDir); qerr != nil {
+		if err == nil {
+			return fmt.Errorf("the entry could not be queued: %v", qerr)
+		}
+		return fmt.Errorf("%v; and the entry could not be queued: %v", err, qerr)
+	}
+
+	if errors.Is(err, errAccessDenied) {
+		return fmt.Errorf("%v. The entry was queued, and will be sent the next time", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not send the entry to the server (%v). It was queued, and will be sent the next time.\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "The entry was queued, and will be sent the next time.\n")
+	}
+	return nil
+}
+
+// queueEntry adds p to the queue, along with a copy of its attachments
+func queueEntry(queueDir string, p pendingEntry, attDir string) error {
+	// Keep a copy of the attachments, as the originals may disappear
+	for _, hash := range p.Attachments {
+		if err := copyFile(filepath.Join(attDir, hash), filepath.Join(queueAttachmentsDir(queueDir), hash), 0600); err != nil {
+			return err
+		}
+	}
+	return enqueue(queueDir, p)
+}
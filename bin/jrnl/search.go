@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+)
+
+var searchCommand = &command{
+	Name:    "search",
+	Args:    "TERM...",
+	Summary: "Search the journal",
+	Help: `
+Search the journal, and print all entries that contain every search term.
+
+On a terminal, the results are formatted and coloured, search terms are
+highlighted, and the output is paged through $PAGER. Use --plain to print the
+entries in the journal format instead. This happens automatically if the
+output is sent to a pipe or a file.
+
+For use in scripts, --format selects a machine-readable output format. The
+json, ndjson and csv formats include the date (RFC 3339), whether the entry is
+starred, the title (the first line), all tags, and the full contents of every
+entry.
+
+Use -from, -to or -on to only search entries in a certain period, and -n to
+only show the most recent results. Dates take the form YYYY-MM-DD or
+YYYY-MM-DD HH:MM; the -to date is inclusive.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		setFilterFlags(fs)
+		setOutputFlags(fs)
+	},
+	Run: runSearch,
+}
+
+func runSearch(fs *flag.FlagSet) error {
+	result, q, err := findEntries("search", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	return printEntries("search", result, q)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+var showCommand = &command{
+	Name:    "show",
+	Args:    "[DATE]",
+	Summary: "Show the entries of a single day",
+	Help: `
+Show all entries written on DATE, which takes the form YYYY-MM-DD. If DATE is
+omitted, the entries of today are shown. DATE may also be 'today' or
+'yesterday'.`,
+	SetFlags: setOutputFlags,
+	Run:      runShow,
+}
+
+func runShow(fs *flag.FlagSet) error {
+	if fs.NArg() > 1 {
+		return usagef("show", "too many arguments")
+	}
+
+	day := time.Now()
+	if fs.NArg() == 1 {
+		var err error
+		day, err = parseDay(fs.Arg(0))
+		if err != nil {
+			return usagef("show", "%v", err)
+		}
+	}
+
+	q := journal.Query{}
+	q.From, q.To = dayRange(day)
+	result, err := journal.Find(*journal_file, q)
+	if err != nil {
+		return err
+	}
+
+	return printEntries("show", result, q)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/thijzert/go-journal"
+)
+
+var statsCommand = &command{
+	Name:    "stats",
+	Args:    "[TERM...]",
+	Summary: "Show statistics about the journal",
+	Help: `
+Show the number of entries and words in the journal, and the period it spans.
+If search terms are given, only entries containing all terms are counted. The
+same filters as in 'jrnl search' can be used to limit the statistics to a
+specific period or set of entries.`,
+	SetFlags: setFilterFlags,
+	Run:      runStats,
+}
+
+func runStats(fs *flag.FlagSet) error {
+	result, _, err := findEntries("stats", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var first, last *journal.Entry
+	var entries, starred, words int
+	days := make(map[string]bool)
+	for e := range result {
+		if first == nil {
+			first = e
+		}
+		last = e
+		entries++
+		if e.Starred {
+			starred++
+		}
+		words += e.Words()
+		days[e.Date.Format("2006-01-02")] = true
+	}
+	if entries == 0 {
+		return errNoEntries
+	}
+
+	fmt.Fprintf(os.Stdout, "Entries:       %d\n", entries)
+	fmt.Fprintf(os.Stdout, "Starred:       %d\n", starred)
+	fmt.Fprintf(os.Stdout, "Words:         %d\n", words)
+	fmt.Fprintf(os.Stdout, "Words/entry:   %.1f\n", float64(words)/float64(entries))
+	fmt.Fprintf(os.Stdout, "Days written:  %d\n", len(days))
+	fmt.Fprintf(os.Stdout, "First entry:   %s\n", first.Date.Format("2006-01-02 15:04"))
+	fmt.Fprintf(os.Stdout, "Last entry:    %s\n", last.Date.Format("2006-01-02 15:04"))
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thijzert/go-journal"
+)
+
+var tagsOpts struct {
+	Sort   string
+	DryRun bool
+}
+
+var tagsCommand = &command{
+	Name:    "tags",
+	Args:    "[rename OLD NEW | merge TAG... INTO]",
+	Summary: "List, rename or merge tags",
+	Help: `
+List every @tag used in the journal, along with the number of entries it
+appears in, and the dates it was first and last used. The most frequently used
+tags are listed first; use --sort to change this.
+
+  jrnl tags rename OLD NEW
+    Rename the tag OLD to NEW in all entries. This fails if NEW is already in
+    use; use merge to combine two tags.
+
+  jrnl tags merge TAG... INTO
+    Replace all the given tags by the last one, e.g.
+    'jrnl tags merge @wetter @Wetter @weather'.
+
+Tags are case sensitive here, so @Wetter and @wetter can be merged. A tag can
+include a value, to rename e.g. "@project Old name" to "@project New name", or
+"@bwv 140" to "@BWV 140". The journal file is rewritten in one go, so it is
+never left half-changed.`,
+	SetFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&tagsOpts.Sort, "sort", "count", "Sort tags by: count, name, first or last")
+		fs.BoolVar(&tagsOpts.DryRun, "dry_run", false, "Only show how many entries would change")
+	},
+	Run: runTags,
+}
+
+type tagCount struct {
+	Tag         string
+	Count       int
+	First, Last time.Time
+}
+
+func runTags(fs *flag.FlagSet) error {
+	if fs.NArg() == 0 {
+		return listTags()
+	}
+
+	// Allow flags after the subcommand, too
+	sub := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return usageError{"tags", err.Error()}
+	}
+	args := fs.Args()
+
+	switch sub {
+	case "rename":
+		if len(args) != 2 {
+			return usagef("tags", "rename needs exactly two tags")
+		}
+		return replaceTags("tags rename", args[:1], args[1], false)
+	case "merge":
+		if len(args) < 2 {
+			return usagef("tags", "merge needs at least two tags")
+		}
+		return replaceTags("tags merge", args[:len(args)-1], args[len(args)-1], true)
+	}
+	return usagef("tags", "unknown subcommand '%s'", sub)
+}
+
+func listTags() error {
+	all, err := journal.Find(*journal_file, journal.Query{})
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]*tagCount)
+	for e := range all {
+		for _, tag := range e.Tags() {
+			tc := counts[tag]
+			if tc == nil {
+				tc = &tagCount{Tag: tag, First: e.Date, Last: e.Date}
+				counts[tag] = tc
+			}
+			tc.Count++
+			if e.Date.Before(tc.First) {
+				tc.First = e.Date
+			}
+			if e.Date.After(tc.Last) {
+				tc.Last = e.Date
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return errNoEntries
+	}
+
+	var tags []*tagCount
+	for _, tc := range counts {
+		tags = append(tags, tc)
+	}
+
+	var less func(a, b *tagCount) bool
+	switch tagsOpts.Sort {
+	case "count":
+		less = func(a, b *tagCount) bool { return a.Count > b.Count }
+	case "name":
+		less = func(a, b *tagCount) bool { return strings.ToLower(a.Tag) < strings.ToLower(b.Tag) }
+	case "first":
+		less = func(a, b *tagCount) bool { return a.First.Before(b.First) }
+	case "last":
+		less = func(a, b *tagCount) bool { return a.Last.After(b.Last) }
+	default:
+		return usagef("tags", "unknown sort order '%s'", tagsOpts.Sort)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if less(tags[i], tags[j]) {
+			return true
+		} else if less(tags[j], tags[i]) {
+			return false
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	for _, tc := range tags {
+		fmt.Fprintf(os.Stdout, "%-24s %5d  %s  %s\n", tc.Tag, tc.Count, tc.First.Format("2006-01-02"), tc.Last.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// normaliseTag checks if s is a valid tag, optionally followed by a value. The
+// leading '@' may be omitted.
+func normaliseTag(command, s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "@") {
+		s = "@" + s
+	}
+
+	tag, value, _ := strings.Cut(s, " ")
+	if locs := journal.FindTags(tag); len(locs) != 1 || locs[0] != [2]int{0, len(tag)} {
+		return "", usagef(command, "'%s' is not a valid tag", s)
+	}
+	if value = strings.TrimSpace(value); value != "" {
+		return tag + " " + value, nil
+	}
+	return tag, nil
+}
+
+// replaceTags replaces the tags in from by into, in every entry. Unless merge
+// is set, into must not be in use yet.
+func replaceTags(command string, from []string, into string, merge bool) error {
+	var err error
+	if into, err = normaliseTag(command, into); err != nil {
+		return err
+	}
+	for i := range from {
+		if from[i], err = normaliseTag(command, from[i]); err != nil {
+			return err
+		}
+		if from[i] == into {
+			return usagef(command, "can't replace %s by itself", into)
+		}
+	}
+
+	// Count the entries that would change, and check if the new tag is in use
+	all, err := journal.Find(*journal_file, journal.Query{})
+	if err != nil {
+		return err
+	}
+	changed, inUse := 0, false
+	for e := range all {
+		if _, n := journal.ReplaceTag(e.Contents, into, into); n > 0 {
+			inUse = true
+		}
+		for _, tag := range from {
+			if _, n := journal.ReplaceTag(e.Contents, tag, into); n > 0 {
+				changed++
+				break
+			}
+		}
+	}
+
+	if inUse && !merge {
+		return fmt.Errorf("%s is already in use. Use 'jrnl tags merge' to combine both tags", into)
+	}
+	if changed == 0 {
+		fmt.Fprintf(os.Stderr, "No entries contain %s\n", strings.Join(from, " or "))
+		return errNoEntries
+	}
+	if tagsOpts.DryRun {
+		fmt.Fprintf(os.Stdout, "%d entries would change\n", changed)
+		return nil
+	}
+
+	err = journal.Rewrite(*journal_file, func(e *journal.Entry) []*journal.Entry {
+		for _, tag := range from {
+			e.Contents, _ = journal.ReplaceTag(e.Contents, tag, into)
+		}
+		return []*journal.Entry{e}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Changed %d entries\n", changed)
+	return nil
+}
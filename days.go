@@ -0,0 +1,45 @@
+package journal
+
+import (
+	"strings"
+	"time"
+)
+
+// A Day summarises the entries written on a single day
+type Day struct {
+	// Date is the start of the day
+	Date time.Time
+
+	// Entries is the number of entries on this day
+	Entries int
+
+	// Words is the total number of words in these entries
+	Words int
+
+	// Starred is set if any of these entries is starred
+	Starred bool
+}
+
+// Words returns the number of words in the entry
+func (e *Entry) Words() int {
+	return len(strings.Fields(e.Contents))
+}
+
+// Days aggregates a stream of entries per day. The result is indexed by the
+// date, formatted as "2006-01-02".
+func Days(entries <-chan *Entry) map[string]*Day {
+	rv := make(map[string]*Day)
+	for e := range entries {
+		key := e.Date.Format("2006-01-02")
+		d := rv[key]
+		if d == nil {
+			y, m, dd := e.Date.Date()
+			d = &Day{Date: time.Date(y, m, dd, 0, 0, 0, 0, e.Date.Location())}
+			rv[key] = d
+		}
+		d.Entries++
+		d.Words += e.Words()
+		d.Starred = d.Starred || e.Starred
+	}
+	return rv
+}
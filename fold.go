@@ -0,0 +1,113 @@
+package journal
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Folding determines which differences between strings are ignored when
+// matching search terms.
+type Folding struct {
+	// IgnoreCase makes "bwv" match "BWV", and "strasse" match "Straße".
+	IgnoreCase bool
+
+	// IgnoreAccents makes "schon" match "schön" by removing all diacritics
+	IgnoreAccents bool
+}
+
+// Fold normalizes s according to f. Two strings that should be considered
+// equal under f fold to the same string. Strings are always brought into
+// Unicode normal form C, so e.g. a decomposed "schön" matches a precomposed
+// one.
+func (f Folding) Fold(s string) string {
+	rv, _ := f.foldOffsets(s, false)
+	return rv
+}
+
+// foldOffsets folds s, and optionally returns a mapping from byte offsets in
+// the folded string back to byte offsets in s. The mapping has one extra
+// element at the end, which maps the end of the folded string to len(s).
+func (f Folding) foldOffsets(s string, wantOffsets bool) (string, []int) {
+	if !f.IgnoreCase && !f.IgnoreAccents && !wantOffsets && norm.NFC.IsNormalString(s) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	var offsets []int
+	if wantOffsets {
+		offsets = make([]int, 0, len(s)+1)
+	}
+	b.Grow(len(s))
+
+	folder := cases.Fold()
+
+	// foldRune adds a single rune to the folded string. All resulting bytes
+	// map back to offset i in s.
+	foldRune := func(r rune, i int) {
+		if r < utf8.RuneSelf {
+			// Fast path for plain ASCII
+			if f.IgnoreCase && 'A' <= r && r <= 'Z' {
+				r += 'a' - 'A'
+			}
+			b.WriteByte(byte(r))
+			if wantOffsets {
+				offsets = append(offsets, i)
+			}
+			return
+		}
+
+		folded := string(r)
+		if f.IgnoreAccents {
+			folded = stripMarks(norm.NFD.String(folded))
+		}
+		if f.IgnoreCase {
+			folded = folder.String(folded)
+		}
+
+		b.WriteString(folded)
+		if wantOffsets {
+			for range []byte(folded) {
+				offsets = append(offsets, i)
+			}
+		}
+	}
+
+	var it norm.Iter
+	it.InitString(norm.NFC, s)
+	for !it.Done() {
+		start := it.Pos()
+		segment := string(it.Next())
+		if segment == s[start:it.Pos()] {
+			// Already normalized; every rune maps back to itself
+			for j, r := range segment {
+				foldRune(r, start+j)
+			}
+		} else {
+			// The composed runes map back to the start of the segment
+			for _, r := range segment {
+				foldRune(r, start)
+			}
+		}
+	}
+
+	if wantOffsets {
+		offsets = append(offsets, len(s))
+	}
+
+	return b.String(), offsets
+}
+
+// stripMarks removes all nonspacing marks (accents, umlauts, etc.) from a
+// decomposed string
+func stripMarks(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
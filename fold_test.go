@@ -0,0 +1,71 @@
+package journal
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	exact         = Folding{}
+	ignoreCase    = Folding{IgnoreCase: true}
+	ignoreAccents = Folding{IgnoreAccents: true}
+	ignoreBoth    = Folding{IgnoreCase: true, IgnoreAccents: true}
+)
+
+func TestFold(t *testing.T) {
+	cases := []struct {
+		f        Folding
+		in, want string
+	}{
+		{exact, "BWV 140", "BWV 140"},
+		{exact, "schön", "schön"},
+		{exact, "scho\u0308n", "schön"},
+		{exact, "e\u0301", "é"},
+		{ignoreCase, "BWV 140", "bwv 140"},
+		{ignoreCase, "Straße", "strasse"},
+		{ignoreCase, "SCHO\u0308N", "schön"},
+		{ignoreAccents, "Schön", "Schon"},
+		{ignoreAccents, "Scho\u0308n", "Schon"},
+		{ignoreAccents, "Straße", "Straße"},
+		{ignoreBoth, "ÉCOLE", "ecole"},
+		{ignoreBoth, "E\u0301cole", "ecole"},
+		{ignoreBoth, "Straße", "strasse"},
+	}
+
+	for _, c := range cases {
+		if got := c.f.Fold(c.in); got != c.want {
+			t.Errorf("%+v.Fold(%q) = %q, want %q", c.f, c.in, got, c.want)
+		}
+	}
+}
+
+func TestFoldOffsets(t *testing.T) {
+	cases := []struct {
+		f       Folding
+		in      string
+		folded  string
+		offsets []int
+	}{
+		{exact, "abc", "abc", []int{0, 1, 2, 3}},
+		{ignoreCase, "ABC", "abc", []int{0, 1, 2, 3}},
+
+		// A decomposed "é" is composed; both bytes map to the "e"
+		{exact, "e\u0301x", "éx", []int{0, 0, 3, 4}},
+		{exact, "éx", "éx", []int{0, 0, 2, 3}},
+
+		// "ß" expands to "ss"; both map to the "ß"
+		{ignoreCase, "aßb", "assb", []int{0, 1, 1, 3, 4}},
+
+		// Accents are removed, and what's left maps to the whole character
+		{ignoreAccents, "schön", "schon", []int{0, 1, 2, 3, 5, 6}},
+		{ignoreAccents, "scho\u0308n", "schon", []int{0, 1, 2, 3, 6, 7}},
+		{ignoreBoth, "ÉtÉ", "ete", []int{0, 2, 3, 5}},
+	}
+
+	for _, c := range cases {
+		folded, offsets := c.f.foldOffsets(c.in, true)
+		if folded != c.folded || !reflect.DeepEqual(offsets, c.offsets) {
+			t.Errorf("%+v.foldOffsets(%q) = %q, %v; want %q, %v", c.f, c.in, folded, offsets, c.folded, c.offsets)
+		}
+	}
+}
@@ -3,7 +3,10 @@ module github.com/thijzert/go-journal
 go 1.20
 
 require (
-	github.com/gorilla/context v1.1.1
 	github.com/gorilla/mux v1.8.0
 	golang.org/x/crypto v0.6.0
+	golang.org/x/term v0.5.0
+	golang.org/x/text v0.7.0
 )
+
+require golang.org/x/sys v0.5.0 // indirect
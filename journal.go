@@ -2,8 +2,11 @@ package journal
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,22 +15,41 @@ const (
 	dateFormat = "2006-01-02 15:04"
 )
 
+// ErrNoDate is returned when the input to Deserialize does not start with the date of an entry
+var ErrNoDate = errors.New("expected a date at the start of the first entry")
+
 type Entry struct {
 	Date     time.Time
 	Starred  bool
 	Contents string
 }
 
-func SmartTime(t string) time.Time {
-	// TODO: Smart time
-	// Parse things like 'Yesterday 15:16' or 'Thursday 2PM'
+// Title returns the first line of the entry
+func (e *Entry) Title() string {
+	if i := strings.IndexByte(e.Contents, '\n'); i != -1 {
+		return e.Contents[:i]
+	}
+	return e.Contents
+}
 
-	tt, err := time.ParseInLocation(dateFormat, t, time.Local)
-	if err == nil && tt.Year() > 1980 {
+// Body returns the contents of the entry after the title
+func (e *Entry) Body() string {
+	if i := strings.IndexByte(e.Contents, '\n'); i != -1 {
+		return e.Contents[i+1:]
+	}
+	return ""
+}
+
+// SmartTime parses a date and time, such as "2023-02-01 15:16" or "yesterday
+// 9pm". It returns the current time if t can't be parsed. See ParseTime for
+// the supported formats.
+func SmartTime(t string) time.Time {
+	now := time.Now()
+	if tt, ok := ParseTime(t, now); ok {
 		return tt
 	}
 
-	return time.Now()
+	return now
 }
 
 func (e *Entry) Serialize(w io.Writer) error {
@@ -105,6 +127,11 @@ func Deserialize(r io.Reader, c chan *Entry) error {
 			err = nil
 		}
 
+		if ent == nil {
+			err = ErrNoDate
+			break
+		}
+
 		for emptyLines > 0 {
 			ent.Contents += "\n"
 			emptyLines--
@@ -129,33 +156,6 @@ func Deserialize(r io.Reader, c chan *Entry) error {
 	return nil
 }
 
-func Search(filename string, terms ...string) (chan *Entry, error) {
-	c := make(chan *Entry, 20)
-	rv := make(chan *Entry, 20)
-
-	go func() {
-		f, _ := os.Open(filename)
-		defer f.Close()
-
-		Deserialize(f, c)
-	}()
-	go func() {
-	Found:
-		for ee := range c {
-			for _, t := range terms {
-				if strings.Index(ee.Contents, t) == -1 {
-					continue Found
-				}
-			}
-			rv <- ee
-		}
-
-		close(rv)
-	}()
-
-	return rv, nil
-}
-
 func Add(filename string, entry *Entry) error {
 	var f *os.File
 	var err error
@@ -228,3 +228,69 @@ func Add(filename string, entry *Entry) error {
 
 	return nil
 }
+
+// Rewrite passes every entry in the journal file through f, and replaces the
+// file with the result. f may return zero entries to remove an entry, or more
+// than one to insert new ones. The resulting entries are sorted by date
+// before writing. The journal file is replaced atomically, so concurrent
+// readers will either see the old or the new version of the journal.
+func Rewrite(filename string, f func(e *Entry) []*Entry) error {
+	r, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+
+	var entries []*Entry
+	c := make(chan *Entry, 25)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Deserialize(r, c)
+	}()
+	for ee := range c {
+		entries = append(entries, f(ee)...)
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	g, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*~")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(g.Name())
+	defer g.Close()
+
+	w := bufio.NewWriter(g)
+	for i, ee := range entries {
+		if i > 0 {
+			w.Write([]byte{0x0a})
+		}
+		if err := ee.Serialize(w); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := g.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := g.Sync(); err != nil {
+		return err
+	}
+	if err := g.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(g.Name(), filename)
+}
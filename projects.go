@@ -0,0 +1,50 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Projects are kept as log files in a projects directory, such as
+// 'Big_plan.txt'. Entries added to a project are tagged with
+// '@project Big plan', and their attachments are copied to 'Big_plan/'.
+//
+// Older versions of journal-server cut one character too many off the names
+// of '.txt' files, so existing entries may be tagged '@project Big pla', and
+// their attachments copied to 'Big_pla/'. ProjectDir keeps using such a
+// directory until it is renamed.
+
+// StripProjectSuffix removes the file extension from the name of a project
+// log file
+func StripProjectSuffix(name string) string {
+	for _, ext := range []string{".txt", ".wiki"} {
+		if len(name) > len(ext) && strings.HasSuffix(name, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// ProjectName formats the name of a project log file for use in the @project
+// tag
+func ProjectName(name string) string {
+	return strings.Replace(StripProjectSuffix(name), "_", " ", -1)
+}
+
+// ProjectDir returns the directory in projectsDir for the attachments of the
+// project with log file name. If that directory doesn't exist, but one with
+// the name older versions of journal-server used does, that one is returned
+// instead.
+func ProjectDir(projectsDir, name string) string {
+	rv := filepath.Join(projectsDir, StripProjectSuffix(name))
+	if _, err := os.Stat(rv); err == nil || len(name) <= len(".txt")+1 || !strings.HasSuffix(name, ".txt") {
+		return rv
+	}
+
+	legacy := filepath.Join(projectsDir, name[:len(name)-len(".txt")-1])
+	if fi, err := os.Stat(legacy); err == nil && fi.IsDir() {
+		return legacy
+	}
+	return rv
+}
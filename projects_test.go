@@ -0,0 +1,67 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectName(t *testing.T) {
+	cases := []struct {
+		file, stripped, name string
+	}{
+		{"Big_plan.txt", "Big_plan", "Big plan"},
+		{"Big_plan.wiki", "Big_plan", "Big plan"},
+		{"Big_plan", "Big_plan", "Big plan"},
+		{"notes.txt.txt", "notes.txt", "notes.txt"},
+		{"a.txt", "a", "a"},
+		{".txt", ".txt", ".txt"},
+		{".wiki", ".wiki", ".wiki"},
+		{"plan.md", "plan.md", "plan.md"},
+	}
+
+	for _, c := range cases {
+		if got := StripProjectSuffix(c.file); got != c.stripped {
+			t.Errorf("StripProjectSuffix(%q) = %q, want %q", c.file, got, c.stripped)
+		}
+		if got := ProjectName(c.file); got != c.name {
+			t.Errorf("ProjectName(%q) = %q, want %q", c.file, got, c.name)
+		}
+	}
+}
+
+func TestProjectDir(t *testing.T) {
+	cases := []struct {
+		name string
+
+		// dirs and files exist in the projects directory
+		dirs, files []string
+		file, want  string
+	}{
+		{"new project", nil, nil, "Big_plan.txt", "Big_plan"},
+		{"existing directory", []string{"Big_plan"}, nil, "Big_plan.txt", "Big_plan"},
+		{"old directory", []string{"Big_pla"}, nil, "Big_plan.txt", "Big_pla"},
+		{"both directories", []string{"Big_pla", "Big_plan"}, nil, "Big_plan.txt", "Big_plan"},
+		{"old name is a file", nil, []string{"Big_pla"}, "Big_plan.txt", "Big_plan"},
+		{"wiki", []string{"Big_pla"}, nil, "Big_plan.wiki", "Big_plan"},
+		{"one letter", nil, nil, "a.txt", "a"},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		for _, d := range c.dirs {
+			if err := os.Mkdir(filepath.Join(dir, d), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, f := range c.files {
+			if err := os.WriteFile(filepath.Join(dir, f), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := ProjectDir(dir, c.file); got != filepath.Join(dir, c.want) {
+			t.Errorf("%s: ProjectDir(%q) = %q, want %q", c.name, c.file, got, filepath.Join(dir, c.want))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package journal
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Query selects journal entries
+type Query struct {
+	// Terms lists the search terms. An entry matches if it contains all terms.
+	Terms []string
+
+	// Folding determines how terms are matched to the entry contents
+	Folding
+
+	// From and To limit the results to entries dated on or after From, and
+	// before To. A zero time means no limit.
+	From, To time.Time
+
+	// Starred limits the results to starred entries
+	Starred bool
+
+	// Tags lists tags that an entry must have, with or without the leading
+	// '@'. Tags are compared using the same folding as the search terms.
+	Tags []string
+}
+
+// compile prepares a query for matching against many entries
+func (q Query) compile() *matcher {
+	rv := &matcher{Query: q}
+	for _, t := range q.Terms {
+		rv.terms = append(rv.terms, q.Fold(t))
+	}
+	for _, t := range q.Tags {
+		if !strings.HasPrefix(t, "@") {
+			t = "@" + t
+		}
+		rv.tags = append(rv.tags, q.Fold(t))
+	}
+	return rv
+}
+
+type matcher struct {
+	Query
+	terms []string
+	tags  []string
+}
+
+func (m *matcher) Match(e *Entry) bool {
+	if !m.From.IsZero() && e.Date.Before(m.From) {
+		return false
+	}
+	if m.past(e) {
+		return false
+	}
+	if m.Starred && !e.Starred {
+		return false
+	}
+
+	if len(m.tags) > 0 {
+		has := make(map[string]bool)
+		for _, t := range e.Tags() {
+			has[m.Fold(t)] = true
+		}
+		for _, t := range m.tags {
+			if !has[t] {
+				return false
+			}
+		}
+	}
+
+	if len(m.terms) == 0 {
+		return true
+	}
+
+	contents := m.Fold(e.Contents)
+	for _, t := range m.terms {
+		if !strings.Contains(contents, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// past tests if e is dated after the end of the query's date range. Since the
+// journal is sorted by date, no entries after e can match either.
+func (m *matcher) past(e *Entry) bool {
+	return !m.To.IsZero() && !e.Date.Before(m.To)
+}
+
+// Match tests if the entry e matches this query
+func (q Query) Match(e *Entry) bool {
+	return q.compile().Match(e)
+}
+
+// Search finds all entries in the journal file that contain all terms,
+// using exact matching.
+func Search(filename string, terms ...string) (chan *Entry, error) {
+	return Find(filename, Query{Terms: terms})
+}
+
+// Find returns all entries in the journal file that match the query q
+func Find(filename string, q Query) (chan *Entry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m := q.compile()
+
+	c := make(chan *Entry, 20)
+	rv := make(chan *Entry, 20)
+
+	go func() {
+		defer f.Close()
+
+		Deserialize(f, c)
+	}()
+	go func() {
+		for ee := range c {
+			if m.past(ee) {
+				// Stop reading the journal, and discard whatever was
+				// already read.
+				f.Close()
+				for range c {
+				}
+				break
+			}
+			if m.Match(ee) {
+				rv <- ee
+			}
+		}
+
+		close(rv)
+	}()
+
+	return rv, nil
+}
+
+// Matches returns the locations of all search terms in s, as pairs of byte
+// offsets. The locations are sorted, and overlapping matches are merged.
+func (q Query) Matches(s string) [][2]int {
+	folded, offsets := q.foldOffsets(s, true)
+
+	var found [][2]int
+	for _, t := range q.Terms {
+		t = q.Fold(t)
+		if t == "" {
+			continue
+		}
+
+		i := 0
+		for {
+			j := strings.Index(folded[i:], t)
+			if j == -1 {
+				break
+			}
+			start, end := i+j, i+j+len(t)
+			for end < len(folded) && offsets[end] == offsets[end-1] {
+				// The match ends halfway through a character that folds to
+				// several, such as "ß" to "ss"; include all of it
+				end++
+			}
+			found = append(found, [2]int{offsets[start], offsets[end]})
+			i = start + 1
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i][0] < found[j][0]
+	})
+
+	var rv [][2]int
+	for _, m := range found {
+		if len(rv) > 0 && m[0] <= rv[len(rv)-1][1] {
+			if m[1] > rv[len(rv)-1][1] {
+				rv[len(rv)-1][1] = m[1]
+			}
+			continue
+		}
+		rv = append(rv, m)
+	}
+	return rv
+}
@@ -0,0 +1,161 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	cases := []struct {
+		f     Folding
+		terms []string
+		s     string
+		want  [][2]int
+	}{
+		{exact, []string{"BWV"}, "Played BWV 140", [][2]int{{7, 10}}},
+		{exact, []string{"bwv"}, "Played BWV 140", nil},
+		{ignoreCase, []string{"bwv"}, "BWV 140 and bwv 147", [][2]int{{0, 3}, {12, 15}}},
+		{exact, []string{""}, "anything", nil},
+
+		// Overlapping and adjacent matches are merged
+		{exact, []string{"ab", "bc"}, "abc", [][2]int{{0, 3}}},
+		{exact, []string{"a"}, "aab", [][2]int{{0, 2}}},
+
+		// Decomposed characters match composed terms, and the other way around
+		{exact, []string{"Schön"}, "Scho\u0308n", [][2]int{{0, 7}}},
+		{exact, []string{"Scho\u0308n"}, "Schön", [][2]int{{0, 6}}},
+		{exact, []string{"e"}, "e\u0301", nil},
+		{ignoreAccents, []string{"e"}, "e\u0301", [][2]int{{0, 3}}},
+		{ignoreAccents, []string{"cafe"}, "Cafe\u0301!", nil},
+		{ignoreBoth, []string{"cafe"}, "Cafe\u0301!", [][2]int{{0, 6}}},
+
+		// Expansions, such as "ß" to "ss", are highlighted in full
+		{ignoreCase, []string{"strasse"}, "Die Straße", [][2]int{{4, 11}}},
+		{ignoreCase, []string{"stras"}, "Die Straße", [][2]int{{4, 10}}},
+		{ignoreCase, []string{"se"}, "Die Straße", [][2]int{{8, 11}}},
+		{ignoreCase, []string{"ss"}, "Straße", [][2]int{{4, 6}}},
+
+		// Accents are highlighted along with the letters they're on
+		{ignoreBoth, []string{"ecole"}, "L'École", [][2]int{{2, 8}}},
+		{ignoreBoth, []string{"te"}, "ÉtÉ", [][2]int{{2, 5}}},
+	}
+
+	for _, c := range cases {
+		q := Query{Terms: c.terms, Folding: c.f}
+		got := q.Matches(c.s)
+		if len(got) == 0 && len(c.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v: Matches(%q, %q) = %v, want %v", c.f, c.terms, c.s, got, c.want)
+			continue
+		}
+		for _, m := range got {
+			if !isValidUTF8Range(c.s, m) {
+				t.Errorf("%+v: Matches(%q, %q): %v splits a character", c.f, c.terms, c.s, m)
+			}
+		}
+	}
+}
+
+// isValidUTF8Range checks if a match starts and ends on character boundaries
+func isValidUTF8Range(s string, m [2]int) bool {
+	for _, i := range m {
+		if i < len(s) && s[i]&0xc0 == 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTestJournal writes a journal with an entry every hour, starting on
+// 2023-02-01 00:00. Every third entry is starred, and every fifth is tagged
+// @five.
+func writeTestJournal(t *testing.T, n int) string {
+	filename := filepath.Join(t.TempDir(), "journal.txt")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	start := time.Date(2023, 2, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < n; i++ {
+		e := &Entry{
+			Date:     start.Add(time.Duration(i) * time.Hour),
+			Starred:  i%3 == 0,
+			Contents: fmt.Sprintf("Entry %d", i),
+		}
+		if i%5 == 0 {
+			e.Contents += "\n@five"
+		}
+		if i > 0 {
+			f.Write([]byte("\n"))
+		}
+		if err := e.Serialize(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+func TestFind(t *testing.T) {
+	// Many more entries than fit in the channels, so reading the journal is
+	// still in progress when Find stops early
+	filename := writeTestJournal(t, 500)
+	at := func(hours int) time.Time {
+		return time.Date(2023, 2, 1, 0, 0, 0, 0, time.Local).Add(time.Duration(hours) * time.Hour)
+	}
+
+	cases := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"first entries", Query{To: at(3)}, []string{"Entry 0", "Entry 1", "Entry 2"}},
+		{"range", Query{From: at(10), To: at(12)}, []string{"Entry 10", "Entry 11"}},
+		{"empty range", Query{From: at(10), To: at(10)}, nil},
+		{"starred", Query{From: at(10), To: at(20), Starred: true}, []string{"Entry 12", "Entry 15", "Entry 18"}},
+		{"tag", Query{To: at(16), Tags: []string{"five"}}, []string{"Entry 0", "Entry 5", "Entry 10", "Entry 15"}},
+		{"term", Query{Terms: []string{"entry 123"}, Folding: ignoreCase}, []string{"Entry 123"}},
+		{"term and end", Query{Terms: []string{"Entry 49"}, To: at(100)}, []string{"Entry 49"}},
+		{"last entry", Query{From: at(499)}, []string{"Entry 499"}},
+		{"after the end", Query{From: at(500)}, nil},
+	}
+
+	for _, c := range cases {
+		results, err := Find(filename, c.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		timeout := time.After(5 * time.Second)
+	read:
+		for {
+			select {
+			case e, ok := <-results:
+				if !ok {
+					break read
+				}
+				got = append(got, e.Title())
+			case <-timeout:
+				t.Fatalf("%s: Find did not finish", c.name)
+			}
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFindMissingFile(t *testing.T) {
+	if _, err := Find(filepath.Join(t.TempDir(), "missing.txt"), Query{}); err == nil {
+		t.Errorf("no error for a missing journal file")
+	}
+}
@@ -0,0 +1,196 @@
+package journal
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHour is the time of day used for dates that don't specify a time
+const DefaultHour = 9
+
+// ParseTime parses a human-friendly description of a point in time, such as
+// "2023-02-01 15:16", "yesterday 9pm", "thursday 14:00", "10:30am" or
+// "2023-02-01". Relative dates are resolved relative to now. If no time of
+// day is given, DefaultHour is used. The second return value is false if s
+// could not be parsed.
+func ParseTime(s string, now time.Time) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range []string{dateFormat, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, t.Year() > 1980
+		}
+	}
+
+	words := strings.Fields(strings.ToLower(s))
+
+	day, n := parseDayWords(words, now)
+	words = words[n:]
+	if len(words) > 0 && words[0] == "at" {
+		words = words[1:]
+	}
+
+	hour, min := DefaultHour, 0
+	if len(words) > 0 {
+		var ok bool
+		hour, min, ok = parseClock(strings.Join(words, ""))
+		if !ok {
+			return time.Time{}, false
+		}
+		if n == 0 {
+			// Only a time was given; assume it's today
+			day = now
+		}
+	} else if n == 0 {
+		return time.Time{}, false
+	}
+
+	y, m, d := day.Date()
+	rv := time.Date(y, m, d, hour, min, 0, 0, now.Location())
+	return rv, rv.Year() > 1980
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// parseDayWords parses the day at the start of words. It returns the day, and
+// the number of words used; or 0 if words does not start with a day.
+func parseDayWords(words []string, now time.Time) (time.Time, int) {
+	if len(words) == 0 {
+		return now, 0
+	}
+
+	switch words[0] {
+	case "today":
+		return now, 1
+	case "yesterday":
+		return now.AddDate(0, 0, -1), 1
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), 1
+	}
+
+	n := 0
+	last := false
+	if words[0] == "last" && len(words) > 1 {
+		n, last = 1, true
+	}
+	if wd, ok := weekdays[words[n]]; ok {
+		// The most recent such weekday. "Last thursday" on a thursday means a week ago.
+		ago := (int(now.Weekday()) - int(wd) + 7) % 7
+		if ago == 0 && last {
+			ago = 7
+		}
+		return now.AddDate(0, 0, -ago), n + 1
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", words[0], now.Location()); err == nil {
+		return t, 1
+	}
+
+	return now, 0
+}
+
+// parseClock parses a time of day, such as "15:16", "9pm", "10:30am" or "noon"
+func parseClock(s string) (hour, min int, ok bool) {
+	switch s {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+
+	ampm := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		ampm = s[len(s)-2:]
+		s = s[:len(s)-2]
+	}
+
+	hs, ms, hasMinutes := strings.Cut(s, ":")
+	if !hasMinutes && ampm == "" {
+		// A bare number is too ambiguous to be a time
+		return 0, 0, false
+	}
+
+	hour, err := strconv.Atoi(hs)
+	if err != nil || len(hs) > 2 {
+		return 0, 0, false
+	}
+	if hasMinutes {
+		min, err = strconv.Atoi(ms)
+		if err != nil || len(ms) != 2 || min > 59 {
+			return 0, 0, false
+		}
+	}
+
+	if ampm != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		if hour == 12 {
+			hour = 0
+		}
+		if ampm == "pm" {
+			hour += 12
+		}
+	} else if hour > 23 {
+		return 0, 0, false
+	}
+
+	return hour, min, true
+}
+
+// InlineDate extracts a jrnl-style date from the text of a new entry. If the
+// text starts with a date followed by a colon (e.g. "yesterday 9pm: ..." or
+// "2023-02-01: ..."), it returns that date and the text after the colon.
+// Otherwise, ok is false.
+func InlineDate(text string, now time.Time) (t time.Time, rest string, ok bool) {
+	title := text
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		title = text[:i]
+	}
+
+	// Look for a colon that ends a valid date. Only look at the start of the
+	// line, as dates aren't very long.
+	for i := 0; i < len(title) && i < 40; i++ {
+		if title[i] != ':' {
+			continue
+		}
+		if i+1 < len(title) && title[i+1] != ' ' && title[i+1] != '\t' {
+			continue
+		}
+		if t, ok := ParseTime(title[:i], now); ok {
+			rest = strings.TrimPrefix(strings.TrimLeft(text[i+1:], " \t"), "\n")
+			return t, rest, true
+		}
+	}
+
+	return time.Time{}, text, false
+}
+
+// InlineStar checks if the first line of text ends in a '*', which stars the
+// entry. It returns the text with the star removed.
+func InlineStar(text string) (rest string, starred bool) {
+	title := text
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		title = text[:i]
+	}
+
+	trimmed := strings.TrimRight(title, " \t")
+	if strings.HasSuffix(trimmed, "*") && strings.Count(trimmed, "*")%2 == 1 {
+		// An odd number of stars means the last one isn't part of *emphasis*
+		return strings.TrimRight(trimmed[:len(trimmed)-1], " \t") + text[len(title):], true
+	}
+
+	return text, false
+}
@@ -0,0 +1,105 @@
+package journal
+
+import (
+	"testing"
+	"time"
+)
+
+// testNow is a Thursday afternoon
+var testNow = time.Date(2023, 2, 2, 15, 16, 0, 0, time.UTC)
+
+func TestParseTime(t *testing.T) {
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2023, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2023-02-01 15:16", at(2, 1, 15, 16), true},
+		{"2023-02-01T15:16", at(2, 1, 15, 16), true},
+		{"2023-02-01 15:16:17", time.Date(2023, 2, 1, 15, 16, 17, 0, time.UTC), true},
+		{"2023-02-01", at(2, 1, DefaultHour, 0), true},
+		{"2023-02-01 9pm", at(2, 1, 21, 0), true},
+
+		{"today", at(2, 2, DefaultHour, 0), true},
+		{"yesterday", at(2, 1, DefaultHour, 0), true},
+		{"tomorrow", at(2, 3, DefaultHour, 0), true},
+		{"  Yesterday 9 PM ", at(2, 1, 21, 0), true},
+		{"yesterday at 10:30am", at(2, 1, 10, 30), true},
+		{"tomorrow at noon", at(2, 3, 12, 0), true},
+		{"today midnight", at(2, 2, 0, 0), true},
+
+		{"thursday 14:00", at(2, 2, 14, 0), true},
+		{"last thursday", at(1, 26, DefaultHour, 0), true},
+		{"monday", at(1, 30, DefaultHour, 0), true},
+		{"last monday", at(1, 30, DefaultHour, 0), true},
+		{"friday 8am", at(1, 27, 8, 0), true},
+
+		{"10:30", at(2, 2, 10, 30), true},
+		{"10:30am", at(2, 2, 10, 30), true},
+		{"10:30pm", at(2, 2, 22, 30), true},
+		{"9pm", at(2, 2, 21, 0), true},
+		{"12am", at(2, 2, 0, 0), true},
+		{"12pm", at(2, 2, 12, 0), true},
+		{"0:05", at(2, 2, 0, 5), true},
+		{"23:59", at(2, 2, 23, 59), true},
+
+		{"", time.Time{}, false},
+		{"9", time.Time{}, false},
+		{"13pm", time.Time{}, false},
+		{"0am", time.Time{}, false},
+		{"24:00", time.Time{}, false},
+		{"10:60", time.Time{}, false},
+		{"10:5", time.Time{}, false},
+		{"123:45", time.Time{}, false},
+		{"someday", time.Time{}, false},
+		{"yesterday banana", time.Time{}, false},
+		{"last", time.Time{}, false},
+		{"1970-01-01", time.Time{}, false},
+	}
+
+	for _, c := range cases {
+		got, ok := ParseTime(c.in, testNow)
+		if ok != c.ok {
+			t.Errorf("ParseTime(%q): ok = %v, want %v", c.in, ok, c.ok)
+			continue
+		}
+		if ok && !got.Equal(c.want) {
+			t.Errorf("ParseTime(%q) = %s, want %s", c.in, got.Format(dateFormat), c.want.Format(dateFormat))
+		}
+	}
+}
+
+func TestInlineDate(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Time
+		rest string
+		ok   bool
+	}{
+		{"yesterday 9pm: Went out", time.Date(2023, 2, 1, 21, 0, 0, 0, time.UTC), "Went out", true},
+		{"2023-02-01: First line\nSecond line", time.Date(2023, 2, 1, DefaultHour, 0, 0, 0, time.UTC), "First line\nSecond line", true},
+		{"2023-02-01 15:16: Coffee", time.Date(2023, 2, 1, 15, 16, 0, 0, time.UTC), "Coffee", true},
+		{"10:30: Coffee", time.Date(2023, 2, 2, 10, 30, 0, 0, time.UTC), "Coffee", true},
+		{"today:\nBody", time.Date(2023, 2, 2, DefaultHour, 0, 0, 0, time.UTC), "Body", true},
+
+		{"Meeting at 10:30 about the budget", time.Time{}, "Meeting at 10:30 about the budget", false},
+		{"Note: nothing happened", time.Time{}, "Note: nothing happened", false},
+		{"No colon\nyesterday: here", time.Time{}, "No colon\nyesterday: here", false},
+		{"", time.Time{}, "", false},
+	}
+
+	for _, c := range cases {
+		got, rest, ok := InlineDate(c.in, testNow)
+		if ok != c.ok || rest != c.rest {
+			t.Errorf("InlineDate(%q) = %q, %v; want %q, %v", c.in, rest, ok, c.rest, c.ok)
+			continue
+		}
+		if ok && !got.Equal(c.want) {
+			t.Errorf("InlineDate(%q): date = %s, want %s", c.in, got.Format(dateFormat), c.want.Format(dateFormat))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package journal
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tagPattern matches tags such as @BWV or @project. A tag must be preceded by
+// whitespace or the start of a line, so that e-mail addresses aren't mistaken
+// for tags.
+var tagPattern = regexp.MustCompile(`(?:^|\s)(@[\pL\pN_][\pL\pN_\-]*)`)
+
+// Tags returns all tags in this entry in order of appearance, including the
+// leading '@'. Each tag is listed only once.
+func (e *Entry) Tags() []string {
+	var rv []string
+	seen := make(map[string]bool)
+	for _, loc := range FindTags(e.Contents) {
+		tag := e.Contents[loc[0]:loc[1]]
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		rv = append(rv, tag)
+	}
+	return rv
+}
+
+// FindTags returns the locations of all tags in s, as pairs of byte offsets
+func FindTags(s string) [][2]int {
+	var rv [][2]int
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(s, -1) {
+		rv = append(rv, [2]int{m[2], m[3]})
+	}
+	return rv
+}
+
+// attachmentPattern matches attachment references, as added by journal-server
+var attachmentPattern = regexp.MustCompile(`(?m)^@attachment ([0-9a-f]{64})\s*$`)
+
+// Attachments returns the hashes of all files attached to this entry
+func (e *Entry) Attachments() []string {
+	var rv []string
+	for _, m := range attachmentPattern.FindAllStringSubmatch(e.Contents, -1) {
+		rv = append(rv, m[1])
+	}
+	return rv
+}
+
+// ReplaceTag replaces every occurrence of the tag old in s by new. The tag
+// may be followed by a value, as in "@project Big Plan" or "@BWV 140"; then
+// only occurrences with the same value are replaced. Tags are matched exactly,
+// so @bwv does not match @BWV or @bwv-anh. It returns the new string, and the
+// number of replacements.
+func ReplaceTag(s, old, new string) (string, int) {
+	oldTag, oldValue := old, ""
+	if i := strings.IndexAny(old, " \t"); i != -1 {
+		oldTag, oldValue = old[:i], old[i:]
+	}
+
+	var b strings.Builder
+	n, last := 0, 0
+	for _, loc := range FindTags(s) {
+		if s[loc[0]:loc[1]] != oldTag || loc[0] < last {
+			continue
+		}
+
+		end := loc[1] + len(oldValue)
+		if !strings.HasPrefix(s[loc[1]:], oldValue) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			// The value continues, e.g. "@BWV 1" in "@BWV 140"
+			continue
+		}
+
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(new)
+		last = end
+		n++
+	}
+	if n == 0 {
+		return s, 0
+	}
+
+	b.WriteString(s[last:])
+	return b.String(), n
+}
@@ -0,0 +1,33 @@
+package journal
+
+import "testing"
+
+func TestReplaceTag(t *testing.T) {
+	cases := []struct {
+		s, old, new string
+		want        string
+		n           int
+	}{
+		{"Practised @BWV 140 today", "@BWV", "@bwv", "Practised @bwv 140 today", 1},
+		{"@BWV 140\n@BWV 147", "@BWV", "@bach", "@bach 140\n@bach 147", 2},
+		{"@BWV 140 and @BWV 1405", "@BWV 140", "@BWV 147", "@BWV 147 and @BWV 1405", 1},
+		{"@BWV 1 and @BWV 140", "@BWV 1", "@BWV 2", "@BWV 2 and @BWV 140", 1},
+		{"@project Big Plan, @project Big Planet", "@project Big Plan", "@project Small Plan", "@project Small Plan, @project Big Planet", 1},
+		{"@bwv-anh 114 and @bwv 1", "@bwv", "@BWV", "@bwv-anh 114 and @BWV 1", 1},
+		{"@BWV 140", "@bwv", "@other", "@BWV 140", 0},
+		{"@café and @caféine", "@café", "@tea", "@tea and @caféine", 1},
+
+		// E-mail addresses are not tags
+		{"Mail me at someone@BWV.org", "@BWV", "@bwv", "Mail me at someone@BWV.org", 0},
+		{"me@example.com wrote about @example", "@example", "@sample", "me@example.com wrote about @sample", 1},
+		{"@example, me@example and (@example)", "@example", "@x", "@x, me@example and (@example)", 1},
+		{"first.last@work\n@work late", "@work", "@office", "first.last@work\n@office late", 1},
+	}
+
+	for _, c := range cases {
+		got, n := ReplaceTag(c.s, c.old, c.new)
+		if got != c.want || n != c.n {
+			t.Errorf("ReplaceTag(%q, %q, %q) = %q, %d; want %q, %d", c.s, c.old, c.new, got, n, c.want, c.n)
+		}
+	}
+}